@@ -15,6 +15,9 @@ import (
 	"github.com/spruce-solutions/go-quai/rpc"
 )
 
+// version is the revision of the blake3 engine reported in its identity.
+const version = "1.0"
+
 // Config are the configuration parameters of Blake3 PoW
 type Config struct {
 	// Number of threads to use when mining.
@@ -150,3 +153,15 @@ func (blake3 *Blake3) APIs(chain consensus.ChainHeaderReader) []rpc.API {
 		},
 	}
 }
+
+// Identity implements consensus.Identifier, returning the name and the version
+// of the engine.
+func (blake3 *Blake3) Identity() (string, string) {
+	return "blake3", version
+}
+
+// SealFields implements consensus.Identifier, returning the header fields filled
+// in by a proof-of-work solution.
+func (blake3 *Blake3) SealFields() []string {
+	return []string{"Nonce"}
+}
@@ -304,6 +304,10 @@ func (blake3 *Blake3) verifyHeader(chain consensus.ChainHeaderReader, header, pa
 // the difficulty that a new block should have when created at time
 // given the parent block's time and difficulty.
 func (blake3 *Blake3) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header, context int) *big.Int {
+	// If we are a faker, use the fake difficulty the headers are verified against
+	if blake3.config.Fakepow {
+		return new(big.Int).Set(fakeDifficulties[context])
+	}
 	return CalcDifficulty(chain.Config(), time, parent, context)
 }
 
@@ -356,11 +360,11 @@ func calcDifficultyFrontier(time uint64, parent *types.Header, context int) *big
 
 // verifySeal checks whether a block satisfies the PoW difficulty requirements,
 func (blake3 *Blake3) verifySeal(header *types.Header) error {
-	difficulty := header.Difficulty[types.QuaiNetworkContext]
-	// If we are a faker, override the difficulty with the appropriate fake difficulty
+	// If we're running a fake PoW, accept any seal as valid
 	if blake3.config.Fakepow {
-		difficulty = fakeDifficulties[types.QuaiNetworkContext]
+		return nil
 	}
+	difficulty := header.Difficulty[types.QuaiNetworkContext]
 	// Ensure that we have a valid difficulty for the block
 	if difficulty.Sign() <= 0 {
 		return errInvalidDifficulty
@@ -394,6 +398,10 @@ func (blake3 *Blake3) GetDifficultyOrder(header *types.Header) (int, error) {
 			}
 		}
 	}
+	// Fake seals don't satisfy any difficulty, consider them of the local context
+	if blake3.config.Fakepow {
+		return types.QuaiNetworkContext, nil
+	}
 	return -1, errors.New("block does not satisfy minimum difficulty")
 }
 
@@ -862,11 +870,7 @@ func accumulateRewards(config *params.ChainConfig, state *state.StateDB, header
 	reward := new(big.Int).Set(blockReward)
 	r := new(big.Int)
 	for _, uncle := range uncles {
-		r.Add(uncle.Number[types.QuaiNetworkContext], big8)
-		r.Sub(r, header.Number[types.QuaiNetworkContext])
-		r.Mul(r, blockReward)
-		r.Div(r, big8)
-		state.AddBalance(uncle.Coinbase[types.QuaiNetworkContext], r)
+		state.AddBalance(uncle.Coinbase[types.QuaiNetworkContext], uncleReward(blockReward, header, uncle))
 
 		r.Div(blockReward, big32)
 		reward.Add(reward, r)
@@ -874,6 +878,30 @@ func accumulateRewards(config *params.ChainConfig, state *state.StateDB, header
 	state.AddBalance(header.Coinbase[types.QuaiNetworkContext], reward)
 }
 
+// RewardParameters implements consensus.Rewarder, returning the constants used
+// by accumulateRewards for the block with the given number.
+func (blake3 *Blake3) RewardParameters(chain consensus.ChainHeaderReader, number uint64) consensus.RewardParams {
+	blockReward := misc.CalculateReward()
+	if chain.Config().IsCatalyst(new(big.Int).SetUint64(number)) {
+		blockReward = new(big.Int)
+	}
+	return consensus.RewardParams{
+		BlockReward:            blockReward,
+		UncleRewardNumerator:   new(big.Int).Set(big8),
+		UncleRewardDenominator: new(big.Int).Set(big8),
+		NephewReward:           new(big.Int).Div(blockReward, big32),
+	}
+}
+
+// uncleReward scales the block reward by the distance between the including
+// block and the uncle.
+func uncleReward(blockReward *big.Int, header *types.Header, uncle *types.Header) *big.Int {
+	r := new(big.Int).Add(uncle.Number[types.QuaiNetworkContext], big8)
+	r.Sub(r, header.Number[types.QuaiNetworkContext])
+	r.Mul(r, blockReward)
+	return r.Div(r, big8)
+}
+
 // Verifies that a header location is valid for a specific config.
 func verifyLocation(location []byte, configLocation []byte) error {
 	switch types.QuaiNetworkContext {
@@ -51,6 +51,8 @@ const (
 	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
 
 	wiggleTime = 500 * time.Millisecond // Random delay (per signer) to allow concurrent signers
+
+	version = "1.0" // Revision of the clique engine reported in its identity
 )
 
 // Clique proof-of-authority protocol constants.
@@ -751,6 +753,18 @@ func (c *Clique) APIs(chain consensus.ChainHeaderReader) []rpc.API {
 	}}
 }
 
+// Identity implements consensus.Identifier, returning the name and the version
+// of the engine.
+func (c *Clique) Identity() (string, string) {
+	return "clique", version
+}
+
+// SealFields implements consensus.Identifier, returning the header fields filled
+// in by the signer.
+func (c *Clique) SealFields() []string {
+	return []string{"Extra"}
+}
+
 // SealHash returns the hash of a block prior to it being sealed.
 func SealHash(header *types.Header) (hash common.Hash) {
 	hasher := sha3.NewLegacyKeccak256()
@@ -163,6 +163,44 @@ type Engine interface {
 	Close() error
 }
 
+// RewardParams are the constants of the block reward formula of an engine. An
+// uncle included d blocks above its own number earns
+// BlockReward * (UncleRewardNumerator - d) / UncleRewardDenominator, and the
+// including block earns an additional NephewReward per uncle.
+type RewardParams struct {
+	BlockReward            *big.Int
+	UncleRewardNumerator   *big.Int
+	UncleRewardDenominator *big.Int
+	NephewReward           *big.Int
+}
+
+// UncleReward returns the reward credited to the coinbase of the given uncle
+// when it is included in the block with the given header.
+func (p RewardParams) UncleReward(header *types.Header, uncle *types.Header) *big.Int {
+	r := new(big.Int).Sub(header.Number[types.QuaiNetworkContext], uncle.Number[types.QuaiNetworkContext])
+	r.Sub(p.UncleRewardNumerator, r)
+	r.Mul(r, p.BlockReward)
+	return r.Div(r, p.UncleRewardDenominator)
+}
+
+// Rewarder is a consensus engine exposing the parameters of its block reward
+// formula.
+type Rewarder interface {
+	// RewardParameters returns the reward constants in effect for the block
+	// with the given number.
+	RewardParameters(chain ChainHeaderReader, number uint64) RewardParams
+}
+
+// Identifier is a consensus engine reporting its identity and the shape of its
+// seal.
+type Identifier interface {
+	// Identity returns the name and version of the consensus engine.
+	Identity() (name string, version string)
+
+	// SealFields returns the header fields a seal of the engine fills in.
+	SealFields() []string
+}
+
 // PoW is a consensus engine based on proof-of-work.
 type PoW interface {
 	Engine
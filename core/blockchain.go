@@ -20,6 +20,7 @@ package core
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -42,6 +43,7 @@ import (
 	"github.com/spruce-solutions/go-quai/core/state/snapshot"
 	"github.com/spruce-solutions/go-quai/core/types"
 	"github.com/spruce-solutions/go-quai/core/vm"
+	"github.com/spruce-solutions/go-quai/crypto"
 	"github.com/spruce-solutions/go-quai/ethclient/quaiclient"
 	"github.com/spruce-solutions/go-quai/ethdb"
 	"github.com/spruce-solutions/go-quai/event"
@@ -87,17 +89,24 @@ var (
 	errInsertionInterrupted = errors.New("insertion is interrupted")
 	errChainStopped         = errors.New("blockchain is stopped")
 	errExtBlockNotFound     = errors.New("error finding external block by context and hash")
+	errUnknownBlock         = errors.New("unknown block")
+	errNotAncestor          = errors.New("block is not an ancestor")
+	errNotAdjacent          = errors.New("blocks are not adjacent")
+	errNoParent             = errors.New("genesis block has no parent")
+	errInvalidRange         = errors.New("invalid block range")
 )
 
 const (
 	bodyCacheLimit      = 256
 	blockCacheLimit     = 256
 	receiptsCacheLimit  = 32
+	uncleSearchLimit    = 1024
 	txLookupCacheLimit  = 1024
 	maxFutureBlocks     = 256
 	maxTimeFutureBlocks = 30
 	TriesInMemory       = 128
 	extBlockQueueLimit  = 1024
+	ancestorPathLimit   = 1024
 
 	// BlockChainVersion ensures that an incompatible database forces a resync from scratch.
 	//
@@ -929,6 +938,18 @@ func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
 	return rawdb.HasBody(bc.db, hash, number)
 }
 
+// HasBlocks checks which of the given blocks are present in the database,
+// reporting the result in the order of the hashes.
+func (bc *BlockChain) HasBlocks(hashes []common.Hash) []bool {
+	present := make([]bool, len(hashes))
+	for i, hash := range hashes {
+		if number := bc.hc.GetBlockNumber(hash); number != nil {
+			present[i] = bc.HasBlock(hash, *number)
+		}
+	}
+	return present
+}
+
 // HasFastBlock checks if a fast block is fully present in the database or not.
 func (bc *BlockChain) HasFastBlock(hash common.Hash, number uint64) bool {
 	if !bc.HasBlock(hash, number) {
@@ -992,6 +1013,497 @@ func (bc *BlockChain) GetBlockByNumber(number uint64) *types.Block {
 	return bc.GetBlock(hash, number)
 }
 
+// BlockSize returns the RLP encoded size of the block with the given hash. The
+// size is cached on the block, so repeated queries are cheap.
+func (bc *BlockChain) BlockSize(hash common.Hash) (uint64, error) {
+	block := bc.GetBlockByHash(hash)
+	if block == nil {
+		return 0, fmt.Errorf("%w: %x", errUnknownBlock, hash)
+	}
+	return uint64(block.Size()), nil
+}
+
+// GetBlockTransactionCount returns the number of transactions in the block with
+// the given hash, without decoding the full block.
+func (bc *BlockChain) GetBlockTransactionCount(hash common.Hash) (int, error) {
+	body := bc.GetBody(hash)
+	if body == nil {
+		return 0, fmt.Errorf("%w: %x", errUnknownBlock, hash)
+	}
+	return len(body.Transactions), nil
+}
+
+// AccountDelta describes how an account changed between two states.
+type AccountDelta struct {
+	BalanceBefore  *big.Int
+	BalanceAfter   *big.Int
+	NonceBefore    uint64
+	NonceAfter     uint64
+	CodeHashBefore common.Hash
+	CodeHashAfter  common.Hash
+}
+
+// StateDiff returns the accounts which changed from the state of the parent
+// block to the one of its child. Only the trie nodes differing between the two
+// states are visited, so the blocks are required to be adjacent. Accounts are
+// identified among the ones referenced by the child block, falling back to the
+// preimage store for the rest.
+func (bc *BlockChain) StateDiff(parentHash, childHash common.Hash) (map[common.Address]AccountDelta, error) {
+	parent := bc.GetBlockByHash(parentHash)
+	if parent == nil {
+		return nil, fmt.Errorf("%w: %x", errUnknownBlock, parentHash)
+	}
+	child := bc.GetBlockByHash(childHash)
+	if child == nil {
+		return nil, fmt.Errorf("%w: %x", errUnknownBlock, childHash)
+	}
+	if child.ParentHash() != parentHash {
+		return nil, fmt.Errorf("%w: %x is not the parent of %x", errNotAdjacent, parentHash, childHash)
+	}
+	before, err := bc.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	after, err := bc.StateAt(child.Root())
+	if err != nil {
+		return nil, err
+	}
+	parentTrie, err := bc.stateCache.OpenTrie(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	childTrie, err := bc.stateCache.OpenTrie(child.Root())
+	if err != nil {
+		return nil, err
+	}
+	// Collect the hashed keys of all accounts created, modified or deleted
+	changed := make(map[common.Hash]struct{})
+	for _, pair := range [][2]state.Trie{{parentTrie, childTrie}, {childTrie, parentTrie}} {
+		it, _ := trie.NewDifferenceIterator(pair[0].NodeIterator(nil), pair[1].NodeIterator(nil))
+		for it.Next(true) {
+			if it.Leaf() {
+				changed[common.BytesToHash(it.LeafKey())] = struct{}{}
+			}
+		}
+		if it.Error() != nil {
+			return nil, it.Error()
+		}
+	}
+	// Resolve the hashed keys to the accounts referenced by the child block
+	candidates := make(map[common.Hash]common.Address)
+	reference := func(addr common.Address) {
+		candidates[crypto.Keccak256Hash(addr.Bytes())] = addr
+	}
+	reference(child.Coinbase())
+	for _, uncle := range child.Uncles() {
+		reference(uncle.Coinbase[types.QuaiNetworkContext])
+	}
+	signer := types.MakeSigner(bc.chainConfig, child.Number())
+	for _, tx := range child.Transactions() {
+		if from, err := types.Sender(signer, tx); err == nil {
+			reference(from)
+		}
+		if to := tx.To(); to != nil {
+			reference(*to)
+		}
+	}
+	for _, receipt := range bc.GetReceiptsByHash(childHash) {
+		if receipt.ContractAddress != (common.Address{}) {
+			reference(receipt.ContractAddress)
+		}
+		for _, l := range receipt.Logs {
+			reference(l.Address)
+		}
+	}
+	diff := make(map[common.Address]AccountDelta, len(changed))
+	for hash := range changed {
+		addr, ok := candidates[hash]
+		if !ok {
+			preimage := childTrie.GetKey(hash.Bytes())
+			if preimage == nil {
+				log.Debug("Unresolvable account in state diff", "hash", hash)
+				continue
+			}
+			addr = common.BytesToAddress(preimage)
+		}
+		diff[addr] = AccountDelta{
+			BalanceBefore:  before.GetBalance(addr),
+			BalanceAfter:   after.GetBalance(addr),
+			NonceBefore:    before.GetNonce(addr),
+			NonceAfter:     after.GetNonce(addr),
+			CodeHashBefore: before.GetCodeHash(addr),
+			CodeHashAfter:  after.GetCodeHash(addr),
+		}
+	}
+	return diff, nil
+}
+
+// AncestorPath returns the headers from the block with the from hash down to and
+// including its ancestor with the to hash, in descending order. The length of
+// the path is bounded by ancestorPathLimit.
+func (bc *BlockChain) AncestorPath(from, to common.Hash) ([]*types.Header, error) {
+	header := bc.GetHeaderByHash(from)
+	if header == nil {
+		return nil, fmt.Errorf("%w: %x", errUnknownBlock, from)
+	}
+	ancestor := bc.GetHeaderByHash(to)
+	if ancestor == nil {
+		return nil, fmt.Errorf("%w: %x", errUnknownBlock, to)
+	}
+	number, target := header.Number[types.QuaiNetworkContext].Uint64(), ancestor.Number[types.QuaiNetworkContext].Uint64()
+	if number < target {
+		return nil, fmt.Errorf("%w: #%d is above #%d", errNotAncestor, target, number)
+	}
+	if number-target >= ancestorPathLimit {
+		return nil, fmt.Errorf("ancestor path too long: %d > %d", number-target+1, ancestorPathLimit)
+	}
+	path := []*types.Header{header}
+	for header.Number[types.QuaiNetworkContext].Uint64() > target {
+		header = bc.GetHeader(header.ParentHash[types.QuaiNetworkContext], header.Number[types.QuaiNetworkContext].Uint64()-1)
+		if header == nil {
+			return nil, fmt.Errorf("%w: parent of #%d", errUnknownBlock, path[len(path)-1].Number[types.QuaiNetworkContext])
+		}
+		path = append(path, header)
+	}
+	if header.Hash() != to {
+		return nil, fmt.Errorf("%w: %x of %x", errNotAncestor, to, from)
+	}
+	return path, nil
+}
+
+// RewardParameters returns the constants of the consensus engine's reward
+// formula for the block with the given number. Engines not exposing them yield
+// empty parameters.
+func (bc *BlockChain) RewardParameters(number uint64) consensus.RewardParams {
+	if rewarder, ok := bc.engine.(consensus.Rewarder); ok {
+		return rewarder.RewardParameters(bc, number)
+	}
+	return consensus.RewardParams{}
+}
+
+// GetParent retrieves the parent of the block with the given hash.
+func (bc *BlockChain) GetParent(hash common.Hash) (*types.Block, error) {
+	header := bc.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, fmt.Errorf("%w: %x", errUnknownBlock, hash)
+	}
+	number := header.Number[types.QuaiNetworkContext].Uint64()
+	if number == 0 {
+		return nil, errNoParent
+	}
+	parent := bc.GetBlock(header.ParentHash[types.QuaiNetworkContext], number-1)
+	if parent == nil {
+		return nil, fmt.Errorf("%w: parent %x", errUnknownBlock, header.ParentHash[types.QuaiNetworkContext])
+	}
+	return parent, nil
+}
+
+// HeaderContext holds the values of a header specific to a single context of the
+// Quai hierarchy.
+type HeaderContext struct {
+	ParentHash        common.Hash
+	UncleHash         common.Hash
+	Coinbase          common.Address
+	Root              common.Hash
+	TxHash            common.Hash
+	ReceiptHash       common.Hash
+	Bloom             types.Bloom
+	Difficulty        *big.Int
+	NetworkDifficulty *big.Int
+	Number            *big.Int
+	GasLimit          uint64
+	GasUsed           uint64
+	Extra             []byte
+	BaseFee           *big.Int
+}
+
+// HeaderContexts holds the per-context values of a header for every context of
+// the Quai hierarchy.
+type HeaderContexts struct {
+	Prime  HeaderContext
+	Region HeaderContext
+	Zone   HeaderContext
+}
+
+// newHeaderContext decodes the values of the given context from the header,
+// leaving the ones the header does not carry unset.
+func newHeaderContext(header *types.Header, context int) HeaderContext {
+	var ctx HeaderContext
+	if context < len(header.ParentHash) {
+		ctx.ParentHash = header.ParentHash[context]
+	}
+	if context < len(header.UncleHash) {
+		ctx.UncleHash = header.UncleHash[context]
+	}
+	if context < len(header.Coinbase) {
+		ctx.Coinbase = header.Coinbase[context]
+	}
+	if context < len(header.Root) {
+		ctx.Root = header.Root[context]
+	}
+	if context < len(header.TxHash) {
+		ctx.TxHash = header.TxHash[context]
+	}
+	if context < len(header.ReceiptHash) {
+		ctx.ReceiptHash = header.ReceiptHash[context]
+	}
+	if context < len(header.Bloom) {
+		ctx.Bloom = header.Bloom[context]
+	}
+	if context < len(header.Difficulty) {
+		ctx.Difficulty = header.Difficulty[context]
+	}
+	if context < len(header.NetworkDifficulty) {
+		ctx.NetworkDifficulty = header.NetworkDifficulty[context]
+	}
+	if context < len(header.Number) {
+		ctx.Number = header.Number[context]
+	}
+	if context < len(header.GasLimit) {
+		ctx.GasLimit = header.GasLimit[context]
+	}
+	if context < len(header.GasUsed) {
+		ctx.GasUsed = header.GasUsed[context]
+	}
+	if context < len(header.Extra) {
+		ctx.Extra = header.Extra[context]
+	}
+	if context < len(header.BaseFee) {
+		ctx.BaseFee = header.BaseFee[context]
+	}
+	return ctx
+}
+
+// GetHeaderContexts retrieves the per-context values of the header with the
+// given hash, decoded for every context of the Quai hierarchy.
+func (bc *BlockChain) GetHeaderContexts(hash common.Hash) (*HeaderContexts, error) {
+	header := bc.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, fmt.Errorf("%w: %x", errUnknownBlock, hash)
+	}
+	header = types.CopyHeader(header)
+	return &HeaderContexts{
+		Prime:  newHeaderContext(header, params.PRIME),
+		Region: newHeaderContext(header, params.REGION),
+		Zone:   newHeaderContext(header, params.ZONE),
+	}, nil
+}
+
+// TxConfirmations returns the number of blocks mined on top of the canonical
+// block including the given transaction, or false if the transaction is not
+// included in the canonical chain.
+func (bc *BlockChain) TxConfirmations(hash common.Hash) (uint64, bool) {
+	lookup := bc.GetTransactionLookup(hash)
+	if lookup == nil {
+		return 0, false
+	}
+	head := bc.CurrentBlock().NumberU64()
+	if lookup.BlockIndex > head {
+		return 0, false
+	}
+	return head - lookup.BlockIndex, true
+}
+
+// GetBlockTime returns the timestamp of the canonical block with the given
+// number without retrieving its body.
+func (bc *BlockChain) GetBlockTime(number uint64) (uint64, error) {
+	if head := bc.CurrentHeader().Number[types.QuaiNetworkContext].Uint64(); number > head {
+		return 0, fmt.Errorf("block number %d exceeds chain height %d", number, head)
+	}
+	header := bc.GetHeaderByNumber(number)
+	if header == nil {
+		return 0, fmt.Errorf("%w: #%d", errUnknownBlock, number)
+	}
+	return header.Time, nil
+}
+
+// proofList collects the nodes of a merkle proof in the order they are written.
+type proofList [][]byte
+
+func (n *proofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+func (n *proofList) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// TxInclusionProof rebuilds the transaction trie of the block with the given
+// hash and returns the merkle proof of the transaction at the given index.
+func (bc *BlockChain) TxInclusionProof(blockHash common.Hash, txIndex uint) ([][]byte, error) {
+	block := bc.GetBlockByHash(blockHash)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %x", errUnknownBlock, blockHash)
+	}
+	txs := block.Transactions()
+	if txIndex >= uint(len(txs)) {
+		return nil, fmt.Errorf("transaction index %d out of range, block has %d transactions", txIndex, len(txs))
+	}
+	tr, err := trie.New(common.Hash{}, trie.NewDatabase(rawdb.NewMemoryDatabase()))
+	if err != nil {
+		return nil, err
+	}
+	types.DeriveSha(txs, tr)
+
+	var proof proofList
+	if err := tr.Prove(rlp.AppendUint64(nil, uint64(txIndex)), 0, &proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// BlockAtDepth retrieves the canonical block the given number of blocks below
+// the current head, i.e. the block with depth confirmations on top of it.
+func (bc *BlockChain) BlockAtDepth(depth uint64) (*types.Block, error) {
+	head := bc.CurrentBlock().NumberU64()
+	if depth > head {
+		return nil, fmt.Errorf("depth %d exceeds chain height %d", depth, head)
+	}
+	block := bc.GetBlockByNumber(head - depth)
+	if block == nil {
+		return nil, fmt.Errorf("%w: #%d", errUnknownBlock, head-depth)
+	}
+	return block, nil
+}
+
+// NextDifficulty returns the difficulty the consensus engine would assign in the
+// active context to a block built on top of the current head right now.
+func (bc *BlockChain) NextDifficulty() *big.Int {
+	return bc.nextDifficulty(uint64(time.Now().Unix()))
+}
+
+// nextDifficulty returns the difficulty of a block built on top of the current
+// head at the given time. Timestamps not past the head are bumped to one second
+// after it, as done when preparing sealing work.
+func (bc *BlockChain) nextDifficulty(timestamp uint64) *big.Int {
+	parent := bc.CurrentBlock().Header()
+	if parent.Time >= timestamp {
+		timestamp = parent.Time + 1
+	}
+	return bc.engine.CalcDifficulty(bc, timestamp, parent, types.QuaiNetworkContext)
+}
+
+// CodeSizeAt returns the size of the code of the given account in the state of
+// the block with the given hash. Accounts without code have a size of zero.
+func (bc *BlockChain) CodeSizeAt(addr common.Address, blockHash common.Hash) (int, error) {
+	block := bc.GetBlockByHash(blockHash)
+	if block == nil {
+		return 0, fmt.Errorf("%w: %x", errUnknownBlock, blockHash)
+	}
+	statedb, err := bc.StateAt(block.Root())
+	if err != nil {
+		return 0, err
+	}
+	return statedb.GetCodeSize(addr), nil
+}
+
+// GetSideBlocksByNumber retrieves all non-canonical blocks stored in the
+// database at the given height.
+func (bc *BlockChain) GetSideBlocksByNumber(number uint64) []*types.Block {
+	var (
+		canonical = rawdb.ReadCanonicalHash(bc.db, number)
+		blocks    []*types.Block
+	)
+	for _, hash := range rawdb.ReadAllHashes(bc.db, number) {
+		if hash == canonical {
+			continue
+		}
+		if block := bc.GetBlock(hash, number); block != nil {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// GetIncludingBlock searches the recent canonical chain, up to uncleSearchLimit
+// blocks deep, for the block which included the given uncle and returns its hash.
+func (bc *BlockChain) GetIncludingBlock(uncleHash common.Hash) (common.Hash, error) {
+	block := bc.CurrentBlock()
+	for i := 0; block != nil && i < uncleSearchLimit; i++ {
+		for _, uncle := range block.Uncles() {
+			if uncle.Hash() == uncleHash {
+				return block.Hash(), nil
+			}
+		}
+		if block.NumberU64() == 0 {
+			break
+		}
+		block = bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	}
+	return common.Hash{}, fmt.Errorf("uncle %x not included in the last %d blocks", uncleHash, uncleSearchLimit)
+}
+
+// TouchedAccounts re-executes the block with the given hash on top of its parent
+// state and returns the accounts modified by it.
+func (bc *BlockChain) TouchedAccounts(hash common.Hash) ([]common.Address, error) {
+	block := bc.GetBlockByHash(hash)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %x", errUnknownBlock, hash)
+	}
+	if block.NumberU64() == 0 {
+		return nil, errors.New("genesis block has no parent state")
+	}
+	parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
+	}
+	statedb, err := bc.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	if _, _, _, _, err := bc.processor.Process(block, statedb, bc.vmConfig); err != nil {
+		return nil, err
+	}
+	return statedb.DirtyAccounts(), nil
+}
+
+// VerifyBlock checks the transaction and uncle hashes of the given block against
+// its header, then re-executes it on top of its parent state and validates the
+// resulting state transition, including the state root.
+func (bc *BlockChain) VerifyBlock(block *types.Block) error {
+	header := block.Header()
+	if hash := types.CalcUncleHash(block.Uncles()); hash != header.UncleHash[types.QuaiNetworkContext] {
+		return fmt.Errorf("uncle root hash mismatch: have %x, want %x", hash, header.UncleHash[types.QuaiNetworkContext])
+	}
+	if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != header.TxHash[types.QuaiNetworkContext] {
+		return fmt.Errorf("transaction root hash mismatch: have %x, want %x", hash, header.TxHash[types.QuaiNetworkContext])
+	}
+	if block.NumberU64() == 0 {
+		return errors.New("genesis block has no parent state")
+	}
+	parent := bc.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	statedb, err := bc.StateAt(parent.Root())
+	if err != nil {
+		return fmt.Errorf("%w: %v", consensus.ErrPrunedAncestor, err)
+	}
+	receipts, _, usedGas, _, err := bc.processor.Process(block, statedb, bc.vmConfig)
+	if err != nil {
+		return err
+	}
+	return bc.validator.ValidateState(block, statedb, receipts, usedGas)
+}
+
+// VerifyReceipts checks the stored receipts of the block with the given hash
+// against the receipt root hash in its header.
+func (bc *BlockChain) VerifyReceipts(blockHash common.Hash) error {
+	header := bc.GetHeaderByHash(blockHash)
+	if header == nil {
+		return fmt.Errorf("%w: %x", errUnknownBlock, blockHash)
+	}
+	receipts := bc.GetReceiptsByHash(blockHash)
+	if receipts == nil {
+		return fmt.Errorf("missing receipts for block %x", blockHash)
+	}
+	if hash := types.DeriveSha(receipts, trie.NewStackTrie(nil)); hash != header.ReceiptHash[types.QuaiNetworkContext] {
+		return fmt.Errorf("receipt root hash mismatch: have %x, want %x", hash, header.ReceiptHash[types.QuaiNetworkContext])
+	}
+	return nil
+}
+
 // GetReceiptsByHash retrieves the receipts for all transactions in a given block.
 func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
 	if receipts, ok := bc.receiptsCache.Get(hash); ok {
@@ -1009,6 +1521,42 @@ func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) types.Receipts {
 	return receipts
 }
 
+// GetReceiptByTxHash retrieves the receipt of the canonical transaction with the
+// given hash, or nil if the transaction is unknown or not yet mined.
+func (bc *BlockChain) GetReceiptByTxHash(hash common.Hash) *types.Receipt {
+	lookup := bc.GetTransactionLookup(hash)
+	if lookup == nil {
+		return nil
+	}
+	receipts := bc.GetReceiptsByHash(lookup.BlockHash)
+	if lookup.Index >= uint64(len(receipts)) {
+		return nil
+	}
+	return receipts[lookup.Index]
+}
+
+// TxIndex retrieves the hash of the canonical block including the transaction
+// with the given hash and the position of the transaction within the block, or
+// false if the transaction is unknown or not yet mined.
+func (bc *BlockChain) TxIndex(hash common.Hash) (blockHash common.Hash, index uint, ok bool) {
+	lookup := bc.GetTransactionLookup(hash)
+	if lookup == nil {
+		return common.Hash{}, 0, false
+	}
+	return lookup.BlockHash, uint(lookup.Index), true
+}
+
+// GetReceiptsByTxHashes retrieves the receipts of the transactions with the given
+// hashes, in the order of the hashes. Unknown or not yet mined transactions have
+// a nil receipt.
+func (bc *BlockChain) GetReceiptsByTxHashes(hashes []common.Hash) []*types.Receipt {
+	receipts := make([]*types.Receipt, len(hashes))
+	for i, hash := range hashes {
+		receipts[i] = bc.GetReceiptByTxHash(hash)
+	}
+	return receipts
+}
+
 // GetBlocksFromHash returns the block corresponding to hash and up to n-1 ancestors.
 // [deprecated by eth/62]
 func (bc *BlockChain) GetBlocksFromHash(hash common.Hash, n int) (blocks []*types.Block) {
@@ -1039,6 +1587,70 @@ func (bc *BlockChain) GetUnclesInChain(block *types.Block, length int) []*types.
 	return uncles
 }
 
+// RecentOrphanRate estimates the rate of orphaned blocks as the share of uncles
+// among the blocks and uncles of the last window canonical blocks.
+func (bc *BlockChain) RecentOrphanRate(window uint64) float64 {
+	head := bc.CurrentBlock()
+	if window == 0 || head == nil {
+		return 0
+	}
+	blocks := window
+	if available := head.NumberU64() + 1; available < blocks {
+		blocks = available
+	}
+	uncles := uint64(len(bc.GetUnclesInChain(head, int(blocks))))
+	return float64(uncles) / float64(blocks+uncles)
+}
+
+// TxCountInRange returns the total number of transactions included in the
+// canonical blocks numbered [start, end].
+func (bc *BlockChain) TxCountInRange(start, end uint64) (uint64, error) {
+	if start > end {
+		return 0, fmt.Errorf("%w: start #%d after end #%d", errInvalidRange, start, end)
+	}
+	if head := bc.CurrentBlock().NumberU64(); end > head {
+		return 0, fmt.Errorf("%w: end #%d beyond head #%d", errInvalidRange, end, head)
+	}
+	var count uint64
+	for number := start; number <= end; number++ {
+		hash := rawdb.ReadCanonicalHash(bc.db, number)
+		body := bc.GetBody(hash)
+		if body == nil {
+			return 0, fmt.Errorf("%w: #%d", errUnknownBlock, number)
+		}
+		count += uint64(len(body.Transactions))
+	}
+	return count, nil
+}
+
+// DifficultyTuples retrieves the per-context difficulties of the last window
+// canonical blocks, ordered from the oldest to the head.
+func (bc *BlockChain) DifficultyTuples(window uint64) [][]*big.Int {
+	head := bc.CurrentHeader()
+	if window == 0 || head == nil {
+		return nil
+	}
+	number := head.Number[types.QuaiNetworkContext].Uint64()
+	if available := number + 1; available < window {
+		window = available
+	}
+	tuples := make([][]*big.Int, window)
+	for i := range tuples {
+		header := bc.GetHeaderByNumber(number - window + 1 + uint64(i))
+		if header == nil {
+			return nil
+		}
+		tuple := make([]*big.Int, len(header.Difficulty))
+		for j, difficulty := range header.Difficulty {
+			if difficulty != nil {
+				tuple[j] = new(big.Int).Set(difficulty)
+			}
+		}
+		tuples[i] = tuple
+	}
+	return tuples
+}
+
 // GetGasUsedInChain retrieves all the gas used from a given block backwards until
 // a specific distance is reached.
 func (bc *BlockChain) GetGasUsedInChain(block *types.Block, length int) int64 {
@@ -2942,6 +3554,25 @@ func (bc *BlockChain) CurrentHeader() *types.Header {
 	return bc.hc.CurrentHeader()
 }
 
+// CurrentNumber retrieves the number of the current head header of the canonical
+// chain in the context the chain operates in, or zero if it is not set.
+func (bc *BlockChain) CurrentNumber() uint64 {
+	head := bc.hc.CurrentHeader()
+	if head == nil || len(head.Number) <= types.QuaiNetworkContext || head.Number[types.QuaiNetworkContext] == nil {
+		return 0
+	}
+	return head.Number[types.QuaiNetworkContext].Uint64()
+}
+
+// ContextHeads retrieves the current head header of every context in the Quai
+// hierarchy. Only the context the chain operates in is tracked locally, so the
+// entries of all other contexts are nil.
+func (bc *BlockChain) ContextHeads() [3]*types.Header {
+	var heads [3]*types.Header
+	heads[types.QuaiNetworkContext] = bc.hc.CurrentHeader()
+	return heads
+}
+
 // GetTd retrieves a block's total difficulty in the canonical chain from the
 // database by hash and number, caching it if found.
 func (bc *BlockChain) GetTd(hash common.Hash, number uint64) []*big.Int {
@@ -3746,6 +4377,12 @@ func (bc *BlockChain) GetDifficultyOrder(header *types.Header) (int, error) {
 	return headerOrder, nil
 }
 
+// CurrentDifficultyOrder retrieves the difficulty order of the current head
+// header of the canonical chain.
+func (bc *BlockChain) CurrentDifficultyOrder() (int, error) {
+	return bc.GetDifficultyOrder(bc.CurrentHeader())
+}
+
 // CheckDominantBlock sends the block to the dominant chain.
 func (bc *BlockChain) CheckDominantBlock(block *types.Block) error {
 	if bc.domClient == nil {
@@ -3884,9 +4521,31 @@ func (bc *BlockChain) GetTransactionLookup(hash common.Hash) *rawdb.LegacyTxLook
 // Config retrieves the chain's fork configuration.
 func (bc *BlockChain) Config() *params.ChainConfig { return bc.chainConfig }
 
+// ConfigJSON returns the chain's fork configuration encoded as JSON.
+func (bc *BlockChain) ConfigJSON() ([]byte, error) { return json.Marshal(bc.chainConfig) }
+
 // Engine retrieves the blockchain's consensus engine.
 func (bc *BlockChain) Engine() consensus.Engine { return bc.engine }
 
+// EngineInfo retrieves the name and version of the consensus engine backing the
+// chain, or "unknown" if the engine doesn't report its identity.
+func (bc *BlockChain) EngineInfo() (name string, version string) {
+	if engine, ok := bc.engine.(consensus.Identifier); ok {
+		return engine.Identity()
+	}
+	return "unknown", ""
+}
+
+// Location retrieves the location of the chain within the Quai hierarchy.
+func (bc *BlockChain) Location() []byte { return common.CopyBytes(bc.chainConfig.Location) }
+
+// GenesisLocation retrieves the location the genesis block was committed at,
+// which may differ from the active location of the chain.
+func (bc *BlockChain) GenesisLocation() []byte { return bc.genesisBlock.Header().Location }
+
+// Context retrieves the network context (prime, region or zone) the chain operates in.
+func (bc *BlockChain) Context() int { return types.QuaiNetworkContext }
+
 // SubscribeRemovedLogsEvent registers a subscription of RemovedLogsEvent.
 func (bc *BlockChain) SubscribeRemovedLogsEvent(ch chan<- RemovedLogsEvent) event.Subscription {
 	return bc.scope.Track(bc.rmLogsFeed.Subscribe(ch))
@@ -17,11 +17,15 @@
 package core
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/big"
 	"os"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -36,6 +40,7 @@ import (
 	"github.com/spruce-solutions/go-quai/crypto"
 	"github.com/spruce-solutions/go-quai/ethdb"
 	"github.com/spruce-solutions/go-quai/params"
+	"github.com/spruce-solutions/go-quai/rlp"
 	"github.com/spruce-solutions/go-quai/trie"
 )
 
@@ -45,17 +50,74 @@ var (
 	forkSeed      = 2
 )
 
+// testChainConfig is the chain configuration of the test chains carrying
+// transactions, using a chain id transactions can be signed for.
+var testChainConfig = func() *params.ChainConfig {
+	config := new(params.ChainConfig)
+	*config = *params.TestChainConfig
+	config.ChainID = big.NewInt(12000)
+	return config
+}()
+
+// newOperableKey generates a key whose address is within the address range of
+// the test chain, as transactions from other addresses are rejected.
+func newOperableKey() *ecdsa.PrivateKey {
+	prefixes := params.LookupChainIDRange(testChainConfig.ChainID)
+	for {
+		key, _ := crypto.GenerateKey()
+		if prefix := int(crypto.PubkeyToAddress(key.PublicKey)[0]); prefix >= prefixes[0] && prefix <= prefixes[1] {
+			return key
+		}
+	}
+}
+
+// signTestTx signs the given transaction for the test chain. Legacy transactions
+// can't be signed with replay protection, so it is converted into an access list
+// transaction with the same fields.
+func signTestTx(tx *types.Transaction, key *ecdsa.PrivateKey) (*types.Transaction, error) {
+	return types.SignNewTx(key, types.LatestSigner(testChainConfig), &types.AccessListTx{
+		ChainID:  testChainConfig.ChainID,
+		Nonce:    tx.Nonce(),
+		To:       tx.To(),
+		Value:    tx.Value(),
+		Gas:      tx.Gas(),
+		GasPrice: tx.GasPrice(),
+		Data:     tx.Data(),
+	})
+}
+
+// newTestBlockChain creates a block chain on top of the given committed genesis,
+// configuring the genesis hashes the fork choice traces coincident blocks to.
+func newTestBlockChain(db ethdb.Database, genesis *types.Block, config *params.ChainConfig, engine consensus.Engine) (*BlockChain, error) {
+	chainConfig := new(params.ChainConfig)
+	*chainConfig = *config
+	chainConfig.GenesisHashes = []common.Hash{genesis.Hash(), genesis.Hash(), genesis.Hash()}
+	return NewBlockChain(db, nil, chainConfig, "", nil, engine, vm.Config{}, nil, nil)
+}
+
+// insertTestChain inserts the given generated blocks into the chain, making them
+// known as blocks of the subordinate contexts first, which the fork choice
+// traces while inserting them.
+func insertTestChain(blockchain *BlockChain, blocks types.Blocks) (int, error) {
+	for _, block := range blocks {
+		for context := types.QuaiNetworkContext + 1; context < types.ContextDepth; context++ {
+			blockchain.AddExternalBlock(types.NewExternalBlockWithHeader(block.Header()).WithBody(block.Transactions(), block.Uncles(), nil, big.NewInt(int64(context))))
+		}
+	}
+	return blockchain.InsertChain(blocks)
+}
+
 // newCanonical creates a chain database, and injects a deterministic canonical
 // chain. Depending on the full flag, if creates either a full block chain or a
 // header only chain.
 func newCanonical(engine consensus.Engine, n int, full bool) (ethdb.Database, *BlockChain, error) {
 	var (
 		db      = rawdb.NewMemoryDatabase()
-		genesis = (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+		genesis = (&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(db)
 	)
 
 	// Initialize a fresh chain with only a genesis block
-	blockchain, _ := NewBlockChain(db, nil, params.AllEthashProtocolChanges, engine, vm.Config{}, nil, nil)
+	blockchain, _ := newTestBlockChain(db, genesis, params.TestChainConfig, engine)
 	// Create and inject the requested chain
 	if n == 0 {
 		return db, blockchain, nil
@@ -63,7 +125,7 @@ func newCanonical(engine consensus.Engine, n int, full bool) (ethdb.Database, *B
 	if full {
 		// Full block-chain requested
 		blocks := makeBlockChain(genesis, n, engine, db, canonicalSeed)
-		_, err := blockchain.InsertChain(blocks)
+		_, err := insertTestChain(blockchain, blocks)
 		return db, blockchain, err
 	}
 	// Header-only chain requested
@@ -117,17 +179,17 @@ func testFork(t *testing.T, blockchain *BlockChain, i, n int, full bool, compara
 	var tdPre, tdPost *big.Int
 
 	if full {
-		tdPre = blockchain.GetTdByHash(blockchain.CurrentBlock().Hash())
+		tdPre = blockchain.GetTdByHash(blockchain.CurrentBlock().Hash())[types.QuaiNetworkContext]
 		if err := testBlockChainImport(blockChainB, blockchain); err != nil {
 			t.Fatalf("failed to import forked block chain: %v", err)
 		}
-		tdPost = blockchain.GetTdByHash(blockChainB[len(blockChainB)-1].Hash())
+		tdPost = blockchain.GetTdByHash(blockChainB[len(blockChainB)-1].Hash())[types.QuaiNetworkContext]
 	} else {
-		tdPre = blockchain.GetTdByHash(blockchain.CurrentHeader().Hash())
+		tdPre = blockchain.GetTdByHash(blockchain.CurrentHeader().Hash())[types.QuaiNetworkContext]
 		if err := testHeaderChainImport(headerChainB, blockchain); err != nil {
 			t.Fatalf("failed to import forked header chain: %v", err)
 		}
-		tdPost = blockchain.GetTdByHash(headerChainB[len(headerChainB)-1].Hash())
+		tdPost = blockchain.GetTdByHash(headerChainB[len(headerChainB)-1].Hash())[types.QuaiNetworkContext]
 	}
 	// Compare the total difficulties of the chains
 	comparator(tdPre, tdPost)
@@ -162,8 +224,12 @@ func testBlockChainImport(chain types.Blocks, blockchain *BlockChain) error {
 			blockchain.reportBlock(block, receipts, err)
 			return err
 		}
+		td, err := blockchain.CalcTd(block.Header())
+		if err != nil {
+			return err
+		}
 		blockchain.chainmu.Lock()
-		rawdb.WriteTd(blockchain.db, block.Hash(), block.NumberU64(), new(big.Int).Add(block.Difficulty(), blockchain.GetTdByHash(block.ParentHash())))
+		rawdb.WriteTd(blockchain.db, block.Hash(), block.NumberU64(), td)
 		rawdb.WriteBlock(blockchain.db, block)
 		statedb.Commit(false)
 		blockchain.chainmu.Unlock()
@@ -179,9 +245,13 @@ func testHeaderChainImport(chain []*types.Header, blockchain *BlockChain) error
 		if err := blockchain.engine.VerifyHeader(blockchain, header, false); err != nil {
 			return err
 		}
+		td, err := blockchain.CalcTd(header)
+		if err != nil {
+			return err
+		}
 		// Manually insert the header into the database, but don't reorganise (allows subsequent testing)
 		blockchain.chainmu.Lock()
-		rawdb.WriteTd(blockchain.db, header.Hash(), header.Number[types.QuaiNetworkContext].Uint64(), new(big.Int).Add(header.Difficulty[types.QuaiNetworkContext], blockchain.GetTdByHash(header.ParentHash[types.QuaiNetworkContext])))
+		rawdb.WriteTd(blockchain.db, header.Hash(), header.Number[types.QuaiNetworkContext].Uint64(), td)
 		rawdb.WriteHeader(blockchain.db, header)
 		blockchain.chainmu.Unlock()
 	}
@@ -434,11 +504,11 @@ func testReorg(t *testing.T, first, second []int64, td int64, full bool) {
 	// Make sure the chain total difficulty is the correct one
 	want := new(big.Int).Add(blockchain.genesisBlock.Difficulty(), big.NewInt(td))
 	if full {
-		if have := blockchain.GetTdByHash(blockchain.CurrentBlock().Hash()); have.Cmp(want) != 0 {
+		if have := blockchain.GetTdByHash(blockchain.CurrentBlock().Hash()); have[types.QuaiNetworkContext].Cmp(want) != 0 {
 			t.Errorf("total difficulty mismatch: have %v, want %v", have, want)
 		}
 	} else {
-		if have := blockchain.GetTdByHash(blockchain.CurrentHeader().Hash()); have.Cmp(want) != 0 {
+		if have := blockchain.GetTdByHash(blockchain.CurrentHeader().Hash()); have[types.QuaiNetworkContext].Cmp(want) != 0 {
 			t.Errorf("total difficulty mismatch: have %v, want %v", have, want)
 		}
 	}
@@ -514,7 +584,7 @@ func testReorgBadHashes(t *testing.T, full bool) {
 	blockchain.Stop()
 
 	// Create a new BlockChain and check that it rolled back the state.
-	ncm, err := NewBlockChain(blockchain.db, nil, blockchain.chainConfig, blake3.NewFaker(), vm.Config{}, nil, nil)
+	ncm, err := NewBlockChain(blockchain.db, nil, blockchain.chainConfig, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create new chain manager: %v", err)
 	}
@@ -604,7 +674,7 @@ func TestFastVsFullChains(t *testing.T) {
 		gspec   = &Genesis{
 			Config:  params.TestChainConfig,
 			Alloc:   GenesisAlloc{address: {Balance: funds}},
-			BaseFee: big.NewInt(params.InitialBaseFee),
+			BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)},
 		}
 		genesis = gspec.MustCommit(gendb)
 		signer  = types.LatestSigner(gspec.Config)
@@ -632,7 +702,7 @@ func TestFastVsFullChains(t *testing.T) {
 	// Import the chain as an archive node for the comparison baseline
 	archiveDb := rawdb.NewMemoryDatabase()
 	gspec.MustCommit(archiveDb)
-	archive, _ := NewBlockChain(archiveDb, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	archive, _ := NewBlockChain(archiveDb, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	defer archive.Stop()
 
 	if n, err := archive.InsertChain(blocks); err != nil {
@@ -641,7 +711,7 @@ func TestFastVsFullChains(t *testing.T) {
 	// Fast import the chain as a non-archive node to test
 	fastDb := rawdb.NewMemoryDatabase()
 	gspec.MustCommit(fastDb)
-	fast, _ := NewBlockChain(fastDb, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	fast, _ := NewBlockChain(fastDb, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	defer fast.Stop()
 
 	headers := make([]*types.Header, len(blocks))
@@ -665,7 +735,7 @@ func TestFastVsFullChains(t *testing.T) {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
 	gspec.MustCommit(ancientDb)
-	ancient, _ := NewBlockChain(ancientDb, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	ancient, _ := NewBlockChain(ancientDb, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	defer ancient.Stop()
 
 	if n, err := ancient.InsertHeaderChain(headers, 1); err != nil {
@@ -679,10 +749,10 @@ func TestFastVsFullChains(t *testing.T) {
 	for i := 0; i < len(blocks); i++ {
 		num, hash := blocks[i].NumberU64(), blocks[i].Hash()
 
-		if ftd, atd := fast.GetTdByHash(hash), archive.GetTdByHash(hash); ftd.Cmp(atd) != 0 {
+		if ftd, atd := fast.GetTdByHash(hash), archive.GetTdByHash(hash); ftd[types.QuaiNetworkContext].Cmp(atd[types.QuaiNetworkContext]) != 0 {
 			t.Errorf("block #%d [%x]: td mismatch: fastdb %v, archivedb %v", num, hash, ftd, atd)
 		}
-		if antd, artd := ancient.GetTdByHash(hash), archive.GetTdByHash(hash); antd.Cmp(artd) != 0 {
+		if antd, artd := ancient.GetTdByHash(hash), archive.GetTdByHash(hash); antd[types.QuaiNetworkContext].Cmp(artd[types.QuaiNetworkContext]) != 0 {
 			t.Errorf("block #%d [%x]: td mismatch: ancientdb %v, archivedb %v", num, hash, antd, artd)
 		}
 		if fheader, aheader := fast.GetHeaderByHash(hash), archive.GetHeaderByHash(hash); fheader.Hash() != aheader.Hash() {
@@ -742,7 +812,7 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 		gspec   = &Genesis{
 			Config:  params.TestChainConfig,
 			Alloc:   GenesisAlloc{address: {Balance: funds}},
-			BaseFee: big.NewInt(params.InitialBaseFee),
+			BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)},
 		}
 		genesis = gspec.MustCommit(gendb)
 	)
@@ -787,7 +857,7 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 	archiveCaching := *defaultCacheConfig
 	archiveCaching.TrieDirtyDisabled = true
 
-	archive, _ := NewBlockChain(archiveDb, &archiveCaching, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	archive, _ := NewBlockChain(archiveDb, &archiveCaching, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	if n, err := archive.InsertChain(blocks); err != nil {
 		t.Fatalf("failed to process block %d: %v", n, err)
 	}
@@ -800,7 +870,7 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 	// Import the chain as a non-archive node and ensure all pointers are updated
 	fastDb, delfn := makeDb()
 	defer delfn()
-	fast, _ := NewBlockChain(fastDb, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	fast, _ := NewBlockChain(fastDb, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	defer fast.Stop()
 
 	headers := make([]*types.Header, len(blocks))
@@ -820,7 +890,7 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 	// Import the chain as a ancient-first node and ensure all pointers are updated
 	ancientDb, delfn := makeDb()
 	defer delfn()
-	ancient, _ := NewBlockChain(ancientDb, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	ancient, _ := NewBlockChain(ancientDb, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	defer ancient.Stop()
 
 	if n, err := ancient.InsertHeaderChain(headers, 1); err != nil {
@@ -839,7 +909,7 @@ func TestLightVsFastVsFullChainHeads(t *testing.T) {
 	// Import the chain as a light node and ensure all pointers are updated
 	lightDb, delfn := makeDb()
 	defer delfn()
-	light, _ := NewBlockChain(lightDb, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	light, _ := NewBlockChain(lightDb, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	if n, err := light.InsertHeaderChain(headers, 1); err != nil {
 		t.Fatalf("failed to insert header %d: %v", n, err)
 	}
@@ -862,7 +932,7 @@ func TestChainTxReorgs(t *testing.T) {
 		db      = rawdb.NewMemoryDatabase()
 		gspec   = &Genesis{
 			Config:   params.TestChainConfig,
-			GasLimit: 3141592,
+			GasLimit: []uint64{3141592, 3141592, 3141592},
 			Alloc: GenesisAlloc{
 				addr1: {Balance: big.NewInt(1000000000000000)},
 				addr2: {Balance: big.NewInt(1000000000000000)},
@@ -908,7 +978,7 @@ func TestChainTxReorgs(t *testing.T) {
 		}
 	})
 	// Import the chain. This runs all block validation rules.
-	blockchain, _ := NewBlockChain(db, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	if i, err := blockchain.InsertChain(chain); err != nil {
 		t.Fatalf("failed to insert original chain[%d]: %v", i, err)
 	}
@@ -978,7 +1048,7 @@ func TestLogReorgs(t *testing.T) {
 		signer  = types.LatestSigner(gspec.Config)
 	)
 
-	blockchain, _ := NewBlockChain(db, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	defer blockchain.Stop()
 
 	rmLogsCh := make(chan RemovedLogsEvent)
@@ -1031,7 +1101,7 @@ func TestLogRebirth(t *testing.T) {
 		genesis       = gspec.MustCommit(db)
 		signer        = types.LatestSigner(gspec.Config)
 		engine        = blake3.NewFaker()
-		blockchain, _ = NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+		blockchain, _ = NewBlockChain(db, nil, gspec.Config, "", nil, engine, vm.Config{}, nil, nil)
 	)
 
 	defer blockchain.Stop()
@@ -1094,7 +1164,7 @@ func TestSideLogRebirth(t *testing.T) {
 		gspec         = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr1: {Balance: big.NewInt(10000000000000000)}}}
 		genesis       = gspec.MustCommit(db)
 		signer        = types.LatestSigner(gspec.Config)
-		blockchain, _ = NewBlockChain(db, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+		blockchain, _ = NewBlockChain(db, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	)
 
 	defer blockchain.Stop()
@@ -1169,7 +1239,7 @@ func TestReorgSideEvent(t *testing.T) {
 		signer  = types.LatestSigner(gspec.Config)
 	)
 
-	blockchain, _ := NewBlockChain(db, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	defer blockchain.Stop()
 
 	chain, _ := GenerateChain(gspec.Config, genesis, blake3.NewFaker(), db, 3, func(i int, gen *BlockGen) {})
@@ -1301,7 +1371,7 @@ func TestEIP155Transition(t *testing.T) {
 		genesis = gspec.MustCommit(db)
 	)
 
-	blockchain, _ := NewBlockChain(db, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	defer blockchain.Stop()
 
 	blocks, _ := GenerateChain(gspec.Config, genesis, blake3.NewFaker(), db, 4, func(i int, block *BlockGen) {
@@ -1409,7 +1479,7 @@ func TestEIP161AccountRemoval(t *testing.T) {
 		}
 		genesis = gspec.MustCommit(db)
 	)
-	blockchain, _ := NewBlockChain(db, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	blockchain, _ := NewBlockChain(db, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	defer blockchain.Stop()
 
 	blocks, _ := GenerateChain(gspec.Config, genesis, blake3.NewFaker(), db, 3, func(i int, block *BlockGen) {
@@ -1466,7 +1536,7 @@ func TestBlockchainHeaderchainReorgConsistency(t *testing.T) {
 	engine := blake3.NewFaker()
 
 	db := rawdb.NewMemoryDatabase()
-	genesis := (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+	genesis := (&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(db)
 	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 64, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{1}) })
 
 	// Generate a bunch of fork blocks, each side forking from the canonical chain
@@ -1482,9 +1552,9 @@ func TestBlockchainHeaderchainReorgConsistency(t *testing.T) {
 	// Import the canonical and fork chain side by side, verifying the current block
 	// and current header consistency
 	diskdb := rawdb.NewMemoryDatabase()
-	(&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(diskdb)
+	(&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(diskdb)
 
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -1511,7 +1581,7 @@ func TestTrieForkGC(t *testing.T) {
 	engine := blake3.NewFaker()
 
 	db := rawdb.NewMemoryDatabase()
-	genesis := (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+	genesis := (&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(db)
 	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 2*TriesInMemory, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{1}) })
 
 	// Generate a bunch of fork blocks, each side forking from the canonical chain
@@ -1526,9 +1596,9 @@ func TestTrieForkGC(t *testing.T) {
 	}
 	// Import the canonical and fork chain side by side, forcing the trie cache to cache both
 	diskdb := rawdb.NewMemoryDatabase()
-	(&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(diskdb)
+	(&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(diskdb)
 
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -1557,7 +1627,7 @@ func TestLargeReorgTrieGC(t *testing.T) {
 	engine := blake3.NewFaker()
 
 	db := rawdb.NewMemoryDatabase()
-	genesis := (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+	genesis := (&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(db)
 
 	shared, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 64, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{1}) })
 	original, _ := GenerateChain(params.TestChainConfig, shared[len(shared)-1], engine, db, 2*TriesInMemory, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{2}) })
@@ -1565,9 +1635,9 @@ func TestLargeReorgTrieGC(t *testing.T) {
 
 	// Import the shared chain and the original canonical one
 	diskdb := rawdb.NewMemoryDatabase()
-	(&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(diskdb)
+	(&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(diskdb)
 
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -1628,7 +1698,7 @@ func TestBlockchainRecovery(t *testing.T) {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
 	gspec.MustCommit(ancientDb)
-	ancient, _ := NewBlockChain(ancientDb, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	ancient, _ := NewBlockChain(ancientDb, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 
 	headers := make([]*types.Header, len(blocks))
 	for i, block := range blocks {
@@ -1648,7 +1718,7 @@ func TestBlockchainRecovery(t *testing.T) {
 	rawdb.WriteHeadFastBlockHash(ancientDb, midBlock.Hash())
 
 	// Reopen broken blockchain again
-	ancient, _ = NewBlockChain(ancientDb, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	ancient, _ = NewBlockChain(ancientDb, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	defer ancient.Stop()
 	if num := ancient.CurrentBlock().NumberU64(); num != 0 {
 		t.Errorf("head block mismatch: have #%v, want #%v", num, 0)
@@ -1700,7 +1770,7 @@ func TestInsertReceiptChainRollback(t *testing.T) {
 	}
 	gspec := Genesis{Config: params.AllEthashProtocolChanges}
 	gspec.MustCommit(ancientDb)
-	ancientChain, _ := NewBlockChain(ancientDb, nil, gspec.Config, blake3.NewFaker(), vm.Config{}, nil, nil)
+	ancientChain, _ := NewBlockChain(ancientDb, nil, gspec.Config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
 	defer ancientChain.Stop()
 
 	// Import the canonical header chain.
@@ -1748,7 +1818,7 @@ func TestLowDiffLongChain(t *testing.T) {
 	// Generate a canonical chain to act as the main dataset
 	engine := blake3.NewFaker()
 	db := rawdb.NewMemoryDatabase()
-	genesis := (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+	genesis := (&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(db)
 
 	// We must use a pretty long chain to ensure that the fork doesn't overtake us
 	// until after at least 128 blocks post tip
@@ -1759,9 +1829,9 @@ func TestLowDiffLongChain(t *testing.T) {
 
 	// Import the canonical chain
 	diskdb := rawdb.NewMemoryDatabase()
-	(&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(diskdb)
+	(&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(diskdb)
 
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -1802,13 +1872,13 @@ func testSideImport(t *testing.T, numCanonBlocksInSidechain, blocksBetweenCommon
 	// Generate a canonical chain to act as the main dataset
 	engine := blake3.NewFaker()
 	db := rawdb.NewMemoryDatabase()
-	genesis := (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+	genesis := (&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(db)
 
 	// Generate and import the canonical chain
 	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 2*TriesInMemory, nil)
 	diskdb := rawdb.NewMemoryDatabase()
-	(&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(diskdb)
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	(&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(diskdb)
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -1882,7 +1952,7 @@ func testInsertKnownChainData(t *testing.T, typ string) {
 	engine := blake3.NewFaker()
 
 	db := rawdb.NewMemoryDatabase()
-	genesis := (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+	genesis := (&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(db)
 
 	blocks, receipts := GenerateChain(params.TestChainConfig, genesis, engine, db, 32, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{1}) })
 	// A longer chain but total difficulty is lower.
@@ -1902,10 +1972,10 @@ func testInsertKnownChainData(t *testing.T, typ string) {
 	if err != nil {
 		t.Fatalf("failed to create temp freezer db: %v", err)
 	}
-	(&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(chaindb)
+	(&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(chaindb)
 	defer os.RemoveAll(dir)
 
-	chain, err := NewBlockChain(chaindb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	chain, err := NewBlockChain(chaindb, nil, params.TestChainConfig, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -2004,7 +2074,7 @@ func getLongAndShortChains() (bc *BlockChain, longChain []*types.Block, heavyCha
 	// Generate a canonical chain to act as the main dataset
 	engine := blake3.NewFaker()
 	db := rawdb.NewMemoryDatabase()
-	genesis := (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+	genesis := (&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(db)
 
 	// Generate and import the canonical chain,
 	// Offset the time, to keep the difficulty low
@@ -2012,9 +2082,9 @@ func getLongAndShortChains() (bc *BlockChain, longChain []*types.Block, heavyCha
 		b.SetCoinbase(common.Address{1})
 	})
 	diskdb := rawdb.NewMemoryDatabase()
-	(&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(diskdb)
+	(&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(diskdb)
 
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to create tester chain: %v", err)
 	}
@@ -2131,7 +2201,7 @@ func TestTransactionIndices(t *testing.T) {
 		gspec   = &Genesis{
 			Config:  params.TestChainConfig,
 			Alloc:   GenesisAlloc{address: {Balance: funds}},
-			BaseFee: big.NewInt(params.InitialBaseFee),
+			BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)},
 		}
 		genesis = gspec.MustCommit(gendb)
 		signer  = types.LatestSigner(gspec.Config)
@@ -2192,7 +2262,7 @@ func TestTransactionIndices(t *testing.T) {
 
 	// Import all blocks into ancient db
 	l := uint64(0)
-	chain, err := NewBlockChain(ancientDb, nil, params.TestChainConfig, blake3.NewFaker(), vm.Config{}, nil, &l)
+	chain, err := NewBlockChain(ancientDb, nil, params.TestChainConfig, "", nil, blake3.NewFaker(), vm.Config{}, nil, &l)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -2217,7 +2287,7 @@ func TestTransactionIndices(t *testing.T) {
 			t.Fatalf("failed to create temp freezer db: %v", err)
 		}
 		gspec.MustCommit(ancientDb)
-		chain, err = NewBlockChain(ancientDb, nil, params.TestChainConfig, blake3.NewFaker(), vm.Config{}, nil, &l)
+		chain, err = NewBlockChain(ancientDb, nil, params.TestChainConfig, "", nil, blake3.NewFaker(), vm.Config{}, nil, &l)
 		if err != nil {
 			t.Fatalf("failed to create tester chain: %v", err)
 		}
@@ -2241,7 +2311,7 @@ func TestTransactionIndices(t *testing.T) {
 	limit = []uint64{0, 64 /* drop stale */, 32 /* shorten history */, 64 /* extend history */, 0 /* restore all */}
 	tails := []uint64{0, 67 /* 130 - 64 + 1 */, 100 /* 131 - 32 + 1 */, 69 /* 132 - 64 + 1 */, 0}
 	for i, l := range limit {
-		chain, err = NewBlockChain(ancientDb, nil, params.TestChainConfig, blake3.NewFaker(), vm.Config{}, nil, &l)
+		chain, err = NewBlockChain(ancientDb, nil, params.TestChainConfig, "", nil, blake3.NewFaker(), vm.Config{}, nil, &l)
 		if err != nil {
 			t.Fatalf("failed to create tester chain: %v", err)
 		}
@@ -2319,7 +2389,7 @@ func TestSkipStaleTxIndicesInFastSync(t *testing.T) {
 
 	// Import all blocks into ancient db, only HEAD-32 indices are kept.
 	l := uint64(32)
-	chain, err := NewBlockChain(ancientDb, nil, params.TestChainConfig, blake3.NewFaker(), vm.Config{}, nil, &l)
+	chain, err := NewBlockChain(ancientDb, nil, params.TestChainConfig, "", nil, blake3.NewFaker(), vm.Config{}, nil, &l)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -2354,7 +2424,7 @@ func benchmarkLargeNumberOfValueToNonexisting(b *testing.B, numTxs, numBlocks in
 					Balance: big.NewInt(0),
 				}, // push 1, pop
 			},
-			GasLimit: 100e6, // 100 M
+			GasLimit: []uint64{100e6, 100e6, 100e6}, // 100 M
 		}
 	)
 	// Generate the original common chain segment and the two competing forks
@@ -2383,7 +2453,7 @@ func benchmarkLargeNumberOfValueToNonexisting(b *testing.B, numTxs, numBlocks in
 		diskdb := rawdb.NewMemoryDatabase()
 		gspec.MustCommit(diskdb)
 
-		chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+		chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{}, nil, nil)
 		if err != nil {
 			b.Fatalf("failed to create tester chain: %v", err)
 		}
@@ -2459,13 +2529,13 @@ func TestSideImportPrunedBlocks(t *testing.T) {
 	// Generate a canonical chain to act as the main dataset
 	engine := blake3.NewFaker()
 	db := rawdb.NewMemoryDatabase()
-	genesis := (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+	genesis := (&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(db)
 
 	// Generate and import the canonical chain
 	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 2*TriesInMemory, nil)
 	diskdb := rawdb.NewMemoryDatabase()
-	(&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(diskdb)
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	(&Genesis{BaseFee: []*big.Int{big.NewInt(params.InitialBaseFee)}}).MustCommit(diskdb)
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -2559,7 +2629,7 @@ func TestDeleteCreateRevert(t *testing.T) {
 	diskdb := rawdb.NewMemoryDatabase()
 	gspec.MustCommit(diskdb)
 
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -2670,7 +2740,7 @@ func TestDeleteRecreateSlots(t *testing.T) {
 	// Import the canonical chain
 	diskdb := rawdb.NewMemoryDatabase()
 	gspec.MustCommit(diskdb)
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{
 		Debug:  true,
 		Tracer: vm.NewJSONLogger(nil, os.Stdout),
 	}, nil, nil)
@@ -2750,7 +2820,7 @@ func TestDeleteRecreateAccount(t *testing.T) {
 	// Import the canonical chain
 	diskdb := rawdb.NewMemoryDatabase()
 	gspec.MustCommit(diskdb)
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{
 		Debug:  true,
 		Tracer: vm.NewJSONLogger(nil, os.Stdout),
 	}, nil, nil)
@@ -2923,7 +2993,7 @@ func TestDeleteRecreateSlotsAcrossManyBlocks(t *testing.T) {
 	// Import the canonical chain
 	diskdb := rawdb.NewMemoryDatabase()
 	gspec.MustCommit(diskdb)
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{
 		//Debug:  true,
 		//Tracer: vm.NewJSONLogger(nil, os.Stdout),
 	}, nil, nil)
@@ -3057,7 +3127,7 @@ func TestInitThenFailCreateContract(t *testing.T) {
 	// Import the canonical chain
 	diskdb := rawdb.NewMemoryDatabase()
 	gspec.MustCommit(diskdb)
-	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, "", nil, engine, vm.Config{
 		//Debug:  true,
 		//Tracer: vm.NewJSONLogger(nil, os.Stdout),
 	}, nil, nil)
@@ -3147,7 +3217,7 @@ func TestEIP2718Transition(t *testing.T) {
 	diskdb := rawdb.NewMemoryDatabase()
 	gspec.MustCommit(diskdb)
 
-	chain, err := NewBlockChain(diskdb, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	chain, err := NewBlockChain(diskdb, nil, gspec.Config, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -3242,7 +3312,7 @@ func TestEIP1559Transition(t *testing.T) {
 	diskdb := rawdb.NewMemoryDatabase()
 	gspec.MustCommit(diskdb)
 
-	chain, err := NewBlockChain(diskdb, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	chain, err := NewBlockChain(diskdb, nil, gspec.Config, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create tester chain: %v", err)
 	}
@@ -3318,3 +3388,1027 @@ func TestEIP1559Transition(t *testing.T) {
 		t.Fatalf("sender balance incorrect: expected %d, got %d", expected, actual)
 	}
 }
+
+// Tests that the chain reports the location and context it was configured with.
+func TestBlockChainLocationContext(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 0, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	if have, want := blockchain.Location(), blockchain.Config().Location; !bytes.Equal(have, want) {
+		t.Errorf("location mismatch: have %v, want %v", have, want)
+	}
+	if have, want := blockchain.Context(), types.QuaiNetworkContext; have != want {
+		t.Errorf("context mismatch: have %d, want %d", have, want)
+	}
+}
+
+// Tests that the reported block size matches the length of its RLP encoding.
+func TestBlockSize(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 4, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	block := blockchain.GetBlockByNumber(3)
+	enc, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		t.Fatalf("failed to encode block: %v", err)
+	}
+	size, err := blockchain.BlockSize(block.Hash())
+	if err != nil {
+		t.Fatalf("failed to retrieve block size: %v", err)
+	}
+	if size != uint64(len(enc)) {
+		t.Errorf("block size mismatch: have %d, want %d", size, len(enc))
+	}
+	if _, err := blockchain.BlockSize(common.Hash{0x01}); !errors.Is(err, errUnknownBlock) {
+		t.Errorf("unknown block error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+}
+
+// Tests that the transaction count of blocks can be retrieved.
+func TestGetBlockTransactionCount(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key     = newOperableKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: testChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = blake3.NewFaker()
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 2, func(i int, block *BlockGen) {
+		if i != 0 {
+			return
+		}
+		for j := 0; j < 2; j++ {
+			tx, err := signTestTx(types.NewTransaction(block.TxNonce(address), common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, block.header.BaseFee[types.QuaiNetworkContext], nil), key)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	blockchain, _ := newTestBlockChain(db, genesis, gspec.Config, engine)
+	defer blockchain.Stop()
+
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for i, want := range []int{2, 0} {
+		count, err := blockchain.GetBlockTransactionCount(blocks[i].Hash())
+		if err != nil {
+			t.Fatalf("block %d: failed to retrieve transaction count: %v", i, err)
+		}
+		if count != want {
+			t.Errorf("block %d: transaction count mismatch: have %d, want %d", i, count, want)
+		}
+	}
+	if _, err := blockchain.GetBlockTransactionCount(common.Hash{0x01}); !errors.Is(err, errUnknownBlock) {
+		t.Errorf("unknown block error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+}
+
+// Tests that the canonical block including an uncle can be resolved.
+func TestGetIncludingBlock(t *testing.T) {
+	engine := blake3.NewFaker()
+	db, blockchain, err := newCanonical(engine, 0, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	genesis := blockchain.Genesis()
+	uncles, _ := GenerateChain(blockchain.Config(), genesis, engine, db, 1, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+	})
+	blocks, _ := GenerateChain(blockchain.Config(), genesis, engine, db, 3, func(i int, gen *BlockGen) {
+		if i == 1 {
+			gen.AddUncle(uncles[0].Header())
+		}
+	})
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	hash, err := blockchain.GetIncludingBlock(uncles[0].Hash())
+	if err != nil {
+		t.Fatalf("failed to resolve including block: %v", err)
+	}
+	if hash != blocks[1].Hash() {
+		t.Errorf("including block mismatch: have %x, want %x", hash, blocks[1].Hash())
+	}
+	if _, err := blockchain.GetIncludingBlock(common.Hash{0x01}); err == nil {
+		t.Errorf("unknown uncle resolved")
+	}
+}
+
+// Tests that the accounts modified by a block are reported.
+func TestTouchedAccounts(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key     = newOperableKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		dest    = common.Address{0xde, 0xad}
+		gspec   = &Genesis{
+			Config: testChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = blake3.NewFaker()
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 1, func(i int, block *BlockGen) {
+		tx, err := signTestTx(types.NewTransaction(block.TxNonce(address), dest, big.NewInt(1000), params.TxGas, block.header.BaseFee[types.QuaiNetworkContext], nil), key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	blockchain, _ := newTestBlockChain(db, genesis, gspec.Config, engine)
+	defer blockchain.Stop()
+
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	touched, err := blockchain.TouchedAccounts(blocks[0].Hash())
+	if err != nil {
+		t.Fatalf("failed to retrieve touched accounts: %v", err)
+	}
+	for _, want := range []common.Address{address, dest} {
+		found := false
+		for _, addr := range touched {
+			if addr == want {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("account %x missing from touched set %v", want, touched)
+		}
+	}
+}
+
+// Tests that full block verification accepts valid blocks and detects tampered
+// transactions.
+func TestVerifyBlock(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key     = newOperableKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: testChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = blake3.NewFaker()
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 2, func(i int, block *BlockGen) {
+		tx, err := signTestTx(types.NewTransaction(block.TxNonce(address), common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, block.header.BaseFee[types.QuaiNetworkContext], nil), key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	blockchain, _ := newTestBlockChain(db, genesis, gspec.Config, engine)
+	defer blockchain.Stop()
+
+	if _, err := insertTestChain(blockchain, blocks[:1]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if err := blockchain.VerifyBlock(blocks[1]); err != nil {
+		t.Errorf("valid block rejected: %v", err)
+	}
+	// Swap the transaction with a different one from the same sender
+	tampered, _ := signTestTx(types.NewTransaction(1, common.Address{0xbe, 0xef}, big.NewInt(1000), params.TxGas, blocks[1].BaseFee(), nil), key)
+	if err := blockchain.VerifyBlock(blocks[1].WithBody(types.Transactions{tampered}, nil)); err == nil {
+		t.Errorf("tampered block accepted")
+	}
+}
+
+// Tests that the head of the active context is reported, and no others.
+func TestContextHeads(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 3, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	for context, head := range blockchain.ContextHeads() {
+		if context == types.QuaiNetworkContext {
+			if head == nil || head.Hash() != blockchain.CurrentHeader().Hash() {
+				t.Errorf("context %d: head mismatch: have %v, want %x", context, head, blockchain.CurrentHeader().Hash())
+			}
+		} else if head != nil {
+			t.Errorf("context %d: untracked head reported: %x", context, head.Hash())
+		}
+	}
+}
+
+// Tests that code sizes are resolved against the state of the requested block.
+func TestCodeSizeAt(t *testing.T) {
+	var (
+		db       = rawdb.NewMemoryDatabase()
+		code     = common.FromHex("0x6000600055")
+		contract = common.Address{0xc0, 0xde}
+		eoa      = common.Address{0xee}
+		gspec    = &Genesis{
+			Config: testChainConfig,
+			Alloc: GenesisAlloc{
+				contract: {Balance: big.NewInt(0), Code: code},
+				eoa:      {Balance: big.NewInt(1)},
+			},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = blake3.NewFaker()
+	)
+	blockchain, _ := newTestBlockChain(db, genesis, gspec.Config, engine)
+	defer blockchain.Stop()
+
+	for i, tt := range []struct {
+		addr common.Address
+		want int
+	}{
+		{contract, len(code)},
+		{eoa, 0},
+	} {
+		size, err := blockchain.CodeSizeAt(tt.addr, genesis.Hash())
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve code size: %v", i, err)
+		}
+		if size != tt.want {
+			t.Errorf("test %d: code size mismatch: have %d, want %d", i, size, tt.want)
+		}
+	}
+	// Store a block whose state is not available
+	header := types.CopyHeader(genesis.Header())
+	header.Number[types.QuaiNetworkContext] = big.NewInt(1)
+	header.ParentHash[types.QuaiNetworkContext] = genesis.Hash()
+	header.Root[types.QuaiNetworkContext] = common.Hash{0x01}
+	pruned := types.NewBlockWithHeader(header)
+	rawdb.WriteBlock(db, pruned)
+
+	if _, err := blockchain.CodeSizeAt(contract, pruned.Hash()); err == nil {
+		t.Errorf("code size retrieved for block without state")
+	}
+}
+
+// Tests that blocks are resolved by their depth below the chain head.
+func TestBlockAtDepth(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 4, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	for _, depth := range []uint64{0, 2, 4} {
+		block, err := blockchain.BlockAtDepth(depth)
+		if err != nil {
+			t.Fatalf("depth %d: failed to retrieve block: %v", depth, err)
+		}
+		if want := blockchain.GetBlockByNumber(4 - depth).Hash(); block.Hash() != want {
+			t.Errorf("depth %d: block mismatch: have %x, want %x", depth, block.Hash(), want)
+		}
+	}
+	if _, err := blockchain.BlockAtDepth(5); err == nil {
+		t.Errorf("block retrieved beyond the chain length")
+	}
+}
+
+// Tests that transaction inclusion proofs verify against the block's tx root.
+func TestTxInclusionProof(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key     = newOperableKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: testChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = blake3.NewFaker()
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 1, func(i int, block *BlockGen) {
+		for j := 0; j < 3; j++ {
+			tx, err := signTestTx(types.NewTransaction(block.TxNonce(address), common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, block.header.BaseFee[types.QuaiNetworkContext], nil), key)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	blockchain, _ := newTestBlockChain(db, genesis, gspec.Config, engine)
+	defer blockchain.Stop()
+
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	block := blocks[0]
+	for i, tx := range block.Transactions() {
+		proof, err := blockchain.TxInclusionProof(block.Hash(), uint(i))
+		if err != nil {
+			t.Fatalf("tx %d: failed to create proof: %v", i, err)
+		}
+		proofDb := rawdb.NewMemoryDatabase()
+		for _, node := range proof {
+			proofDb.Put(crypto.Keccak256(node), node)
+		}
+		value, err := trie.VerifyProof(block.Header().TxHash[types.QuaiNetworkContext], rlp.AppendUint64(nil, uint64(i)), proofDb)
+		if err != nil {
+			t.Fatalf("tx %d: failed to verify proof: %v", i, err)
+		}
+		enc, _ := tx.MarshalBinary()
+		if !bytes.Equal(value, enc) {
+			t.Errorf("tx %d: proven value mismatch: have %x, want %x", i, value, enc)
+		}
+	}
+	if _, err := blockchain.TxInclusionProof(block.Hash(), 3); err == nil {
+		t.Errorf("proof created for out of range index")
+	}
+	if _, err := blockchain.TxInclusionProof(common.Hash{0x01}, 0); !errors.Is(err, errUnknownBlock) {
+		t.Errorf("unknown block error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+}
+
+// Tests that stored receipts are verified against the block's receipt root.
+func TestVerifyReceipts(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key     = newOperableKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: testChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = blake3.NewFaker()
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 2, func(i int, block *BlockGen) {
+		tx, err := signTestTx(types.NewTransaction(block.TxNonce(address), common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, block.header.BaseFee[types.QuaiNetworkContext], nil), key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	blockchain, _ := newTestBlockChain(db, genesis, gspec.Config, engine)
+	defer blockchain.Stop()
+
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if err := blockchain.VerifyReceipts(blocks[0].Hash()); err != nil {
+		t.Errorf("consistent receipts rejected: %v", err)
+	}
+	// Corrupt the receipts of the second block before they are cached
+	block := blocks[1]
+	receipts := rawdb.ReadRawReceipts(db, block.Hash(), block.NumberU64())
+	receipts[0].CumulativeGasUsed++
+	rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts)
+
+	if err := blockchain.VerifyReceipts(block.Hash()); err == nil {
+		t.Errorf("corrupted receipts accepted")
+	}
+	if err := blockchain.VerifyReceipts(common.Hash{0x01}); !errors.Is(err, errUnknownBlock) {
+		t.Errorf("unknown block error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+}
+
+// Tests that the predicted difficulty matches the one assigned by the engine
+// when preparing a header on top of the current head.
+func TestNextDifficulty(t *testing.T) {
+	engine := blake3.NewFaker()
+	_, blockchain, err := newCanonical(engine, 4, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	head := blockchain.CurrentBlock()
+	for i, tt := range []struct {
+		timestamp uint64 // Timestamp the difficulty is requested for
+		prepared  uint64 // Timestamp of the prepared header
+	}{
+		{head.Time() + 10, head.Time() + 10},
+		{head.Time(), head.Time() + 1},
+	} {
+		header := types.NewEmptyHeader()
+		header.ParentHash[types.QuaiNetworkContext] = head.Hash()
+		header.Number[types.QuaiNetworkContext] = new(big.Int).Add(head.Number(), common.Big1)
+		header.Time = tt.prepared
+		if err := engine.Prepare(blockchain, header); err != nil {
+			t.Fatalf("test %d: failed to prepare header: %v", i, err)
+		}
+		want := header.Difficulty[types.QuaiNetworkContext]
+		if have := blockchain.nextDifficulty(tt.timestamp); have.Cmp(want) != 0 {
+			t.Errorf("test %d: difficulty mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	// The public accessor builds on top of the head at the current time
+	if have, want := blockchain.NextDifficulty(), blockchain.nextDifficulty(uint64(time.Now().Unix())); have.Cmp(want) != 0 {
+		t.Errorf("current difficulty mismatch: have %v, want %v", have, want)
+	}
+}
+
+// Tests that block timestamps are retrievable by number.
+func TestGetBlockTime(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 4, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	for number := uint64(0); number <= 4; number++ {
+		have, err := blockchain.GetBlockTime(number)
+		if err != nil {
+			t.Fatalf("block %d: failed to retrieve time: %v", number, err)
+		}
+		if want := blockchain.GetBlockByNumber(number).Time(); have != want {
+			t.Errorf("block %d: time mismatch: have %d, want %d", number, have, want)
+		}
+	}
+	if _, err := blockchain.GetBlockTime(5); err == nil {
+		t.Errorf("time retrieved beyond the chain length")
+	}
+}
+
+// Tests that ancestor paths are assembled in descending order and that targets
+// outside of the ancestry are rejected.
+func TestAncestorPath(t *testing.T) {
+	engine := blake3.NewFaker()
+	db, blockchain, err := newCanonical(engine, 4, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	head := blockchain.CurrentBlock()
+	path, err := blockchain.AncestorPath(head.Hash(), blockchain.GetBlockByNumber(1).Hash())
+	if err != nil {
+		t.Fatalf("failed to retrieve ancestor path: %v", err)
+	}
+	if len(path) != 4 {
+		t.Fatalf("path length mismatch: have %d, want %d", len(path), 4)
+	}
+	for i, header := range path {
+		if want := blockchain.GetBlockByNumber(4 - uint64(i)).Hash(); header.Hash() != want {
+			t.Errorf("path entry %d mismatch: have %x, want %x", i, header.Hash(), want)
+		}
+	}
+	// A block on a side chain is not an ancestor of the head
+	fork := makeBlockChain(blockchain.GetBlockByNumber(1), 2, engine, db, forkSeed)
+	if _, err := insertTestChain(blockchain, fork); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	if _, err := blockchain.AncestorPath(head.Hash(), fork[0].Hash()); !errors.Is(err, errNotAncestor) {
+		t.Errorf("side block error mismatch: have %v, want %v", err, errNotAncestor)
+	}
+	// Descendants are not ancestors either
+	if _, err := blockchain.AncestorPath(blockchain.GetBlockByNumber(1).Hash(), head.Hash()); !errors.Is(err, errNotAncestor) {
+		t.Errorf("descendant error mismatch: have %v, want %v", err, errNotAncestor)
+	}
+}
+
+// Tests that the state diff between adjacent blocks reports the accounts touched
+// by a value transfer.
+func TestStateDiff(t *testing.T) {
+	var (
+		db        = rawdb.NewMemoryDatabase()
+		key       = newOperableKey()
+		address   = crypto.PubkeyToAddress(key.PublicKey)
+		recipient = common.Address{0xde, 0xad}
+		funds     = big.NewInt(1000000000000000)
+		gspec     = &Genesis{
+			Config: testChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: funds}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = blake3.NewFaker()
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 2, func(i int, block *BlockGen) {
+		if i == 0 {
+			tx, err := signTestTx(types.NewTransaction(block.TxNonce(address), recipient, big.NewInt(1000), params.TxGas, block.header.BaseFee[types.QuaiNetworkContext], nil), key)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	blockchain, _ := newTestBlockChain(db, genesis, gspec.Config, engine)
+	defer blockchain.Stop()
+
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	diff, err := blockchain.StateDiff(genesis.Hash(), blocks[0].Hash())
+	if err != nil {
+		t.Fatalf("failed to diff states: %v", err)
+	}
+	sender, ok := diff[address]
+	if !ok {
+		t.Fatalf("sender missing from state diff")
+	}
+	if sender.NonceBefore != 0 || sender.NonceAfter != 1 {
+		t.Errorf("sender nonce mismatch: have %d -> %d, want 0 -> 1", sender.NonceBefore, sender.NonceAfter)
+	}
+	if sender.BalanceBefore.Cmp(funds) != 0 || new(big.Int).Sub(funds, sender.BalanceAfter).Cmp(big.NewInt(1000)) <= 0 {
+		t.Errorf("sender balance mismatch: have %v -> %v", sender.BalanceBefore, sender.BalanceAfter)
+	}
+	receiver, ok := diff[recipient]
+	if !ok {
+		t.Fatalf("recipient missing from state diff")
+	}
+	if receiver.BalanceBefore.Sign() != 0 || receiver.BalanceAfter.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v -> %v, want 0 -> 1000", receiver.BalanceBefore, receiver.BalanceAfter)
+	}
+	if _, err := blockchain.StateDiff(genesis.Hash(), blocks[1].Hash()); !errors.Is(err, errNotAdjacent) {
+		t.Errorf("non-adjacent error mismatch: have %v, want %v", err, errNotAdjacent)
+	}
+}
+
+// Tests that the reward parameters reproduce the rewards credited by the engine.
+func TestRewardParameters(t *testing.T) {
+	engine := blake3.NewFaker()
+	_, blockchain, err := newCanonical(engine, 2, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	var (
+		header = blockchain.GetBlockByNumber(2).Header()
+		uncle  = blockchain.GetBlockByNumber(1).Header()
+		rp     = blockchain.RewardParameters(2)
+	)
+	distance := new(big.Int).Sub(header.Number[types.QuaiNetworkContext], uncle.Number[types.QuaiNetworkContext])
+	want := new(big.Int).Sub(rp.UncleRewardNumerator, distance)
+	want.Mul(want, rp.BlockReward)
+	want.Div(want, rp.UncleRewardDenominator)
+	if have := rp.UncleReward(header, uncle); have.Cmp(want) != 0 {
+		t.Errorf("uncle reward mismatch: have %v, want %v", have, want)
+	}
+	if want := new(big.Int).Div(rp.BlockReward, big.NewInt(32)); rp.NephewReward.Cmp(want) != 0 {
+		t.Errorf("nephew reward mismatch: have %v, want %v", rp.NephewReward, want)
+	}
+}
+
+// Tests that parents are retrievable directly by the hash of their child.
+func TestGetParent(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 2, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	parent, err := blockchain.GetParent(blockchain.GetBlockByNumber(2).Hash())
+	if err != nil {
+		t.Fatalf("failed to retrieve parent: %v", err)
+	}
+	if want := blockchain.GetBlockByNumber(1).Hash(); parent.Hash() != want {
+		t.Errorf("parent mismatch: have %x, want %x", parent.Hash(), want)
+	}
+	if _, err := blockchain.GetParent(blockchain.Genesis().Hash()); !errors.Is(err, errNoParent) {
+		t.Errorf("genesis error mismatch: have %v, want %v", err, errNoParent)
+	}
+	if _, err := blockchain.GetParent(common.Hash{0x01}); !errors.Is(err, errUnknownBlock) {
+		t.Errorf("unknown block error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+}
+
+// Tests that transaction confirmations are counted from the including block.
+func TestTxConfirmations(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key     = newOperableKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: testChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = blake3.NewFaker()
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 4, func(i int, block *BlockGen) {
+		if i == 0 || i == 3 {
+			tx, err := signTestTx(types.NewTransaction(block.TxNonce(address), common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, block.header.BaseFee[types.QuaiNetworkContext], nil), key)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	blockchain, _ := newTestBlockChain(db, genesis, gspec.Config, engine)
+	defer blockchain.Stop()
+
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for i, tt := range []struct {
+		hash common.Hash
+		want uint64
+	}{
+		{blocks[0].Transactions()[0].Hash(), 3},
+		{blocks[3].Transactions()[0].Hash(), 0},
+	} {
+		have, ok := blockchain.TxConfirmations(tt.hash)
+		if !ok {
+			t.Fatalf("test %d: confirmations not found", i)
+		}
+		if have != tt.want {
+			t.Errorf("test %d: confirmations mismatch: have %d, want %d", i, have, tt.want)
+		}
+	}
+	pending, _ := signTestTx(types.NewTransaction(2, common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, big.NewInt(params.InitialBaseFee), nil), key)
+	if _, ok := blockchain.TxConfirmations(pending.Hash()); ok {
+		t.Errorf("confirmations reported for unmined transaction")
+	}
+}
+
+// Tests that the exported chain config round-trips through JSON.
+func TestConfigJSON(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 0, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	blob, err := blockchain.ConfigJSON()
+	if err != nil {
+		t.Fatalf("failed to export config: %v", err)
+	}
+	var config params.ChainConfig
+	if err := json.Unmarshal(blob, &config); err != nil {
+		t.Fatalf("failed to decode config: %v", err)
+	}
+	if !reflect.DeepEqual(&config, blockchain.Config()) {
+		t.Errorf("config mismatch: have %v, want %v", &config, blockchain.Config())
+	}
+}
+
+// Tests that the current head number matches the current header's number.
+func TestCurrentNumber(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 0, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	if number := blockchain.CurrentNumber(); number != 0 {
+		t.Fatalf("genesis number mismatch: have %d, want 0", number)
+	}
+	headers := makeHeaderChain(blockchain.CurrentHeader(), 8, blake3.NewFaker(), blockchain.db, 0)
+	if _, err := blockchain.InsertHeaderChain(headers, 1); err != nil {
+		t.Fatalf("failed to insert headers: %v", err)
+	}
+	want := blockchain.CurrentHeader().Number[types.QuaiNetworkContext].Uint64()
+	if number := blockchain.CurrentNumber(); number != want {
+		t.Errorf("head number mismatch: have %d, want %d", number, want)
+	}
+}
+
+// Tests that block existence is reported in the order of the queried hashes.
+func TestHasBlocks(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 3, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	hashes := []common.Hash{
+		blockchain.GetBlockByNumber(2).Hash(),
+		{0x01},
+		blockchain.Genesis().Hash(),
+		{0x02},
+		blockchain.GetBlockByNumber(3).Hash(),
+	}
+	want := []bool{true, false, true, false, true}
+	if have := blockchain.HasBlocks(hashes); !reflect.DeepEqual(have, want) {
+		t.Errorf("block existence mismatch: have %v, want %v", have, want)
+	}
+}
+
+// Tests that the orphan rate is computed from the uncles in the window.
+func TestRecentOrphanRate(t *testing.T) {
+	engine := blake3.NewFaker()
+	db, blockchain, err := newCanonical(engine, 0, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	if rate := blockchain.RecentOrphanRate(10); rate != 0 {
+		t.Fatalf("genesis orphan rate mismatch: have %v, want 0", rate)
+	}
+	genesis := blockchain.Genesis()
+	uncles1, _ := GenerateChain(blockchain.Config(), genesis, engine, db, 1, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x01})
+	})
+	uncles2, _ := GenerateChain(blockchain.Config(), genesis, engine, db, 1, func(i int, gen *BlockGen) {
+		gen.SetCoinbase(common.Address{0x02})
+	})
+	blocks, _ := GenerateChain(blockchain.Config(), genesis, engine, db, 4, func(i int, gen *BlockGen) {
+		switch i {
+		case 1:
+			gen.AddUncle(uncles1[0].Header())
+		case 3:
+			gen.AddUncle(uncles2[0].Header())
+		}
+	})
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for _, tt := range []struct {
+		window uint64
+		want   float64
+	}{
+		{0, 0},
+		{1, 1.0 / 2},
+		{2, 1.0 / 3},
+		{10, 2.0 / 7},
+	} {
+		if rate := blockchain.RecentOrphanRate(tt.window); rate != tt.want {
+			t.Errorf("window %d: orphan rate mismatch: have %v, want %v", tt.window, rate, tt.want)
+		}
+	}
+}
+
+// Tests that the decoded header contexts match the raw header slices.
+func TestGetHeaderContexts(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 2, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	header := blockchain.GetHeaderByNumber(2)
+	contexts, err := blockchain.GetHeaderContexts(header.Hash())
+	if err != nil {
+		t.Fatalf("failed to retrieve header contexts: %v", err)
+	}
+	for context, ctx := range []HeaderContext{contexts.Prime, contexts.Region, contexts.Zone} {
+		if ctx.ParentHash != header.ParentHash[context] {
+			t.Errorf("context %d: parent hash mismatch: have %x, want %x", context, ctx.ParentHash, header.ParentHash[context])
+		}
+		if ctx.Root != header.Root[context] {
+			t.Errorf("context %d: root mismatch: have %x, want %x", context, ctx.Root, header.Root[context])
+		}
+		if ctx.Coinbase != header.Coinbase[context] {
+			t.Errorf("context %d: coinbase mismatch: have %x, want %x", context, ctx.Coinbase, header.Coinbase[context])
+		}
+		if !reflect.DeepEqual(ctx.Number, header.Number[context]) {
+			t.Errorf("context %d: number mismatch: have %v, want %v", context, ctx.Number, header.Number[context])
+		}
+		if !reflect.DeepEqual(ctx.Difficulty, header.Difficulty[context]) {
+			t.Errorf("context %d: difficulty mismatch: have %v, want %v", context, ctx.Difficulty, header.Difficulty[context])
+		}
+		if !reflect.DeepEqual(ctx.BaseFee, header.BaseFee[context]) {
+			t.Errorf("context %d: base fee mismatch: have %v, want %v", context, ctx.BaseFee, header.BaseFee[context])
+		}
+		if ctx.GasLimit != header.GasLimit[context] || ctx.GasUsed != header.GasUsed[context] {
+			t.Errorf("context %d: gas mismatch: have %d/%d, want %d/%d", context, ctx.GasUsed, ctx.GasLimit, header.GasUsed[context], header.GasLimit[context])
+		}
+	}
+	if _, err := blockchain.GetHeaderContexts(common.Hash{0x01}); !errors.Is(err, errUnknownBlock) {
+		t.Errorf("unknown header error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+}
+
+// Tests that the genesis location is read from the genesis block rather than
+// the active chain configuration.
+func TestGenesisLocation(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &Genesis{Config: params.TestChainConfig, Location: []byte{1, 2}}
+		genesis = gspec.MustCommit(db)
+	)
+	config := *params.TestChainConfig
+	config.Location = []byte{2, 1}
+
+	blockchain, err := NewBlockChain(db, nil, &config, "", nil, blake3.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	if location := blockchain.GenesisLocation(); !bytes.Equal(location, gspec.Location) {
+		t.Errorf("genesis location mismatch: have %v, want %v", location, gspec.Location)
+	}
+	if location := genesis.Header().Location; !bytes.Equal(location, gspec.Location) {
+		t.Errorf("genesis header location mismatch: have %v, want %v", location, gspec.Location)
+	}
+	if location := blockchain.Location(); !bytes.Equal(location, config.Location) {
+		t.Errorf("active location mismatch: have %v, want %v", location, config.Location)
+	}
+}
+
+// Tests that receipts are retrieved in the order of the transaction hashes.
+func TestGetReceiptsByTxHashes(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key     = newOperableKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: testChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = blake3.NewFaker()
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 2, func(i int, block *BlockGen) {
+		tx, err := signTestTx(types.NewTransaction(block.TxNonce(address), common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, block.header.BaseFee[types.QuaiNetworkContext], nil), key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	blockchain, _ := newTestBlockChain(db, genesis, gspec.Config, engine)
+	defer blockchain.Stop()
+
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	pending, _ := signTestTx(types.NewTransaction(2, common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, big.NewInt(params.InitialBaseFee), nil), key)
+	hashes := []common.Hash{
+		{0x01},
+		blocks[1].Transactions()[0].Hash(),
+		pending.Hash(),
+		blocks[0].Transactions()[0].Hash(),
+	}
+	receipts := blockchain.GetReceiptsByTxHashes(hashes)
+	if len(receipts) != len(hashes) {
+		t.Fatalf("receipt count mismatch: have %d, want %d", len(receipts), len(hashes))
+	}
+	for i, hash := range hashes {
+		known := i == 1 || i == 3
+		if (receipts[i] != nil) != known {
+			t.Errorf("receipt %d: presence mismatch: have %v, want %v", i, receipts[i] != nil, known)
+			continue
+		}
+		if known && receipts[i].TxHash != hash {
+			t.Errorf("receipt %d: transaction mismatch: have %x, want %x", i, receipts[i].TxHash, hash)
+		}
+	}
+}
+
+// Tests that the including block and position of transactions are reported.
+func TestTxIndex(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key     = newOperableKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: testChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = blake3.NewFaker()
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 1, func(i int, block *BlockGen) {
+		for j := 0; j < 3; j++ {
+			tx, err := signTestTx(types.NewTransaction(block.TxNonce(address), common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, block.header.BaseFee[types.QuaiNetworkContext], nil), key)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	blockchain, _ := newTestBlockChain(db, genesis, gspec.Config, engine)
+	defer blockchain.Stop()
+
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for i, tx := range blocks[0].Transactions() {
+		blockHash, index, ok := blockchain.TxIndex(tx.Hash())
+		if !ok {
+			t.Fatalf("transaction %d: index not found", i)
+		}
+		if blockHash != blocks[0].Hash() || index != uint(i) {
+			t.Errorf("transaction %d: position mismatch: have %x/%d, want %x/%d", i, blockHash, index, blocks[0].Hash(), i)
+		}
+	}
+	pending, _ := signTestTx(types.NewTransaction(3, common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, big.NewInt(params.InitialBaseFee), nil), key)
+	if _, _, ok := blockchain.TxIndex(pending.Hash()); ok {
+		t.Errorf("index reported for unmined transaction")
+	}
+}
+
+// Tests that the difficulty order of the head matches the one of its header.
+func TestCurrentDifficultyOrder(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 2, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	order, err := blockchain.CurrentDifficultyOrder()
+	want, wantErr := blockchain.GetDifficultyOrder(blockchain.CurrentHeader())
+	if order != want || (err == nil) != (wantErr == nil) {
+		t.Errorf("difficulty order mismatch: have %d (%v), want %d (%v)", order, err, want, wantErr)
+	}
+}
+
+// Tests that the transaction count over a range of canonical blocks sums up
+// the transactions of the individual blocks.
+func TestTxCountInRange(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		key     = newOperableKey()
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: testChainConfig,
+			Alloc:  GenesisAlloc{address: {Balance: big.NewInt(1000000000000000)}},
+		}
+		genesis = gspec.MustCommit(db)
+		engine  = blake3.NewFaker()
+	)
+	// Include i transactions in the i-th block
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, db, 4, func(i int, block *BlockGen) {
+		for j := 0; j < i; j++ {
+			tx, err := signTestTx(types.NewTransaction(block.TxNonce(address), common.Address{0xde, 0xad}, big.NewInt(1000), params.TxGas, block.header.BaseFee[types.QuaiNetworkContext], nil), key)
+			if err != nil {
+				panic(err)
+			}
+			block.AddTx(tx)
+		}
+	})
+	blockchain, _ := newTestBlockChain(db, genesis, gspec.Config, engine)
+	defer blockchain.Stop()
+
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	for start := uint64(0); start <= 4; start++ {
+		for end := start; end <= 4; end++ {
+			var want uint64
+			for n := start; n <= end; n++ {
+				want += uint64(len(blockchain.GetBlockByNumber(n).Transactions()))
+			}
+			have, err := blockchain.TxCountInRange(start, end)
+			if err != nil {
+				t.Fatalf("range [%d, %d]: failed to count transactions: %v", start, end, err)
+			}
+			if have != want {
+				t.Errorf("range [%d, %d]: transaction count mismatch: have %d, want %d", start, end, have, want)
+			}
+		}
+	}
+	if _, err := blockchain.TxCountInRange(3, 2); !errors.Is(err, errInvalidRange) {
+		t.Errorf("reversed range error mismatch: have %v, want %v", err, errInvalidRange)
+	}
+	if _, err := blockchain.TxCountInRange(0, 5); !errors.Is(err, errInvalidRange) {
+		t.Errorf("range beyond head error mismatch: have %v, want %v", err, errInvalidRange)
+	}
+}
+
+// Tests that the reported engine identity reflects the configured engine.
+func TestEngineInfo(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 0, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	if name, version := blockchain.EngineInfo(); name != "blake3" || version == "" {
+		t.Errorf("engine info mismatch: have %q/%q, want %q/<version>", name, version, "blake3")
+	}
+}
+
+// Tests that the difficulty tuples of the recent canonical blocks are returned
+// in ascending order.
+func TestDifficultyTuples(t *testing.T) {
+	_, blockchain, err := newCanonical(blake3.NewFaker(), 0, true)
+	if err != nil {
+		t.Fatalf("failed to create pristine chain: %v", err)
+	}
+	defer blockchain.Stop()
+
+	blocks := makeBlockChain(blockchain.CurrentBlock(), 5, blake3.NewFaker(), blockchain.db, 0)
+	if _, err := insertTestChain(blockchain, blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	check := func(window uint64, want []*types.Block) {
+		t.Helper()
+
+		tuples := blockchain.DifficultyTuples(window)
+		if len(tuples) != len(want) {
+			t.Fatalf("window %d: tuple count mismatch: have %d, want %d", window, len(tuples), len(want))
+		}
+		for i, block := range want {
+			difficulty := block.Header().Difficulty
+			if len(tuples[i]) != len(difficulty) {
+				t.Fatalf("window %d, block #%d: context count mismatch: have %d, want %d", window, block.NumberU64(), len(tuples[i]), len(difficulty))
+			}
+			for j := range difficulty {
+				if tuples[i][j].Cmp(difficulty[j]) != 0 {
+					t.Errorf("window %d, block #%d: context %d difficulty mismatch: have %v, want %v", window, block.NumberU64(), j, tuples[i][j], difficulty[j])
+				}
+			}
+		}
+	}
+	check(0, nil)
+	check(3, blocks[2:])
+	check(10, append([]*types.Block{blockchain.Genesis()}, blocks...))
+}
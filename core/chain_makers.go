@@ -354,6 +354,7 @@ func makeHeader(chain consensus.ChainReader, parent *types.Block, state *state.S
 
 	header.ParentHash[types.QuaiNetworkContext] = parent.Hash()
 	header.Coinbase[types.QuaiNetworkContext] = parent.Coinbase()
+	header.GasLimit[types.QuaiNetworkContext] = parent.GasLimit()
 	header.Difficulty[types.QuaiNetworkContext] = engine.CalcDifficulty(chain, time, parentHeader, types.QuaiNetworkContext)
 
 	header.Number[types.QuaiNetworkContext] = new(big.Int).Add(parent.Number(), common.Big1)
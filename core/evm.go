@@ -48,7 +48,7 @@ func NewEVMBlockContext(header *types.Header, chain ChainContext, author *common
 	} else {
 		beneficiary = *author
 	}
-	if header.BaseFee != nil {
+	if header.BaseFee != nil && header.BaseFee[types.QuaiNetworkContext] != nil {
 		baseFee = new(big.Int).Set(header.BaseFee[types.QuaiNetworkContext])
 	}
 	return vm.BlockContext{
@@ -25,6 +25,7 @@ func (g Genesis) MarshalJSON() ([]byte, error) {
 		GasLimit   []math.HexOrDecimal64                         `json:"gasLimit"   gencodec:"required"`
 		Difficulty []*math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
 		Coinbase   []common.Address                              `json:"coinbase"`
+		Location   hexutil.Bytes                                 `json:"location"`
 		Alloc      map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
 		Number     []math.HexOrDecimal64                         `json:"number"`
 		GasUsed    []math.HexOrDecimal64                         `json:"gasUsed"`
@@ -39,6 +40,7 @@ func (g Genesis) MarshalJSON() ([]byte, error) {
 	enc.GasLimit = []math.HexOrDecimal64{math.HexOrDecimal64(g.GasLimit[0]), math.HexOrDecimal64(g.GasLimit[1]), math.HexOrDecimal64(g.GasLimit[2])}
 	enc.Difficulty = []*math.HexOrDecimal256{(*math.HexOrDecimal256)(g.Difficulty[0]), (*math.HexOrDecimal256)(g.Difficulty[1]), (*math.HexOrDecimal256)(g.Difficulty[2])}
 	enc.Coinbase = g.Coinbase
+	enc.Location = g.Location
 	if g.Alloc != nil {
 		enc.Alloc = make(map[common.UnprefixedAddress]GenesisAccount, len(g.Alloc))
 		for k, v := range g.Alloc {
@@ -62,6 +64,7 @@ func (g *Genesis) UnmarshalJSON(input []byte) error {
 		GasLimit   []*math.HexOrDecimal64                        `json:"gasLimit"   gencodec:"required"`
 		Difficulty []*math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
 		Coinbase   []*common.Address                             `json:"coinbase"`
+		Location   *hexutil.Bytes                                `json:"location"`
 		Alloc      map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
 		Number     []*math.HexOrDecimal64                        `json:"number"`
 		GasUsed    []*math.HexOrDecimal64                        `json:"gasUsed"`
@@ -95,6 +98,9 @@ func (g *Genesis) UnmarshalJSON(input []byte) error {
 	if dec.Coinbase != nil {
 		g.Coinbase = []common.Address{*dec.Coinbase[0], *dec.Coinbase[1], *dec.Coinbase[2]}
 	}
+	if dec.Location != nil {
+		g.Location = *dec.Location
+	}
 	if dec.Alloc == nil {
 		return errors.New("missing required field 'alloc' for Genesis")
 	}
@@ -56,6 +56,7 @@ type Genesis struct {
 	GasLimit   []uint64         `json:"gasLimit"   gencodec:"required"`
 	Difficulty []*big.Int       `json:"difficulty" gencodec:"required"`
 	Coinbase   []common.Address `json:"coinbase"`
+	Location   []byte           `json:"location"`
 	Alloc      GenesisAlloc     `json:"alloc"      gencodec:"required"`
 
 	// These fields are used for consensus tests. Please don't use them
@@ -284,6 +285,7 @@ func (g *Genesis) ToBlock(db ethdb.Database) *types.Block {
 		GasUsed:    g.GasUsed,
 		Difficulty: g.Difficulty,
 		Coinbase:   g.Coinbase,
+		Location:   g.Location,
 		Nonce:      types.EncodeNonce(g.Nonce),
 		Time:       g.Timestamp,
 		BaseFee:    []*big.Int{baseFee, baseFee, baseFee},
@@ -293,6 +295,27 @@ func (g *Genesis) ToBlock(db ethdb.Database) *types.Block {
 	if len(g.GasLimit) == 0 {
 		head.GasLimit = []uint64{params.GenesisGasLimit, params.GenesisGasLimit, params.GenesisGasLimit}
 	}
+	if len(g.Number) == 0 {
+		head.Number = []*big.Int{new(big.Int), new(big.Int), new(big.Int)}
+	}
+	if len(g.ParentHash) == 0 {
+		head.ParentHash = make([]common.Hash, types.ContextDepth)
+	}
+	if len(g.Coinbase) == 0 {
+		head.Coinbase = make([]common.Address, types.ContextDepth)
+	}
+	if len(g.ExtraData) == 0 {
+		head.Extra = make([][]byte, types.ContextDepth)
+	}
+	if len(g.GasUsed) == 0 {
+		head.GasUsed = make([]uint64, types.ContextDepth)
+	}
+	if len(g.Difficulty) == 0 {
+		head.Difficulty = make([]*big.Int, len(params.GenesisDifficulty))
+		for i, difficulty := range params.GenesisDifficulty {
+			head.Difficulty[i] = new(big.Int).Set(difficulty)
+		}
+	}
 
 	statedb.Commit(false)
 	statedb.Database().TrieDB().Commit(root, true, nil)
@@ -317,7 +340,7 @@ func (g *Genesis) Commit(db ethdb.Database) (*types.Block, error) {
 	if config.Clique != nil && len(block.Extra()) == 0 {
 		return nil, errors.New("can't start clique chain without signers")
 	}
-	rawdb.WriteTd(db, block.Hash(), block.NumberU64(), g.Difficulty)
+	rawdb.WriteTd(db, block.Hash(), block.NumberU64(), block.Header().Difficulty)
 	rawdb.WriteBlock(db, block)
 	rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), nil)
 	rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
@@ -480,29 +480,47 @@ func NewEmptyHeader() *Header {
 // modifying a header variable.
 func CopyHeader(h *Header) *Header {
 	cpy := *h
-	for i := 0; i < ContextDepth; i++ {
-		if len(h.Difficulty) > i && h.Difficulty[i] != nil {
-			cpy.Difficulty[i].Set(h.Difficulty[i])
-		}
-		if len(h.NetworkDifficulty) > i && h.NetworkDifficulty[i] != nil {
-			cpy.NetworkDifficulty[i].Set(h.NetworkDifficulty[i])
-		}
-		if len(h.Number) > i && h.Number[i] != nil {
-			cpy.Number[i].Set(h.Number[i])
-		}
-		if len(h.BaseFee) > i && h.BaseFee != nil && h.BaseFee[i] != nil {
-			cpy.BaseFee[i] = new(big.Int).Set(h.BaseFee[i])
-		}
-		if len(h.Extra) > i {
-			if len(h.Extra[i]) > 0 {
-				cpy.Extra[i] = make([]byte, len(h.Extra[i]))
-				copy(cpy.Extra[i], h.Extra[i])
+	cpy.ParentHash = append([]common.Hash(nil), h.ParentHash...)
+	cpy.UncleHash = append([]common.Hash(nil), h.UncleHash...)
+	cpy.Coinbase = append([]common.Address(nil), h.Coinbase...)
+	cpy.Root = append([]common.Hash(nil), h.Root...)
+	cpy.TxHash = append([]common.Hash(nil), h.TxHash...)
+	cpy.ReceiptHash = append([]common.Hash(nil), h.ReceiptHash...)
+	cpy.Bloom = append([]Bloom(nil), h.Bloom...)
+	cpy.GasLimit = append([]uint64(nil), h.GasLimit...)
+	cpy.GasUsed = append([]uint64(nil), h.GasUsed...)
+	cpy.Difficulty = copyBigInts(h.Difficulty)
+	cpy.NetworkDifficulty = copyBigInts(h.NetworkDifficulty)
+	cpy.Number = copyBigInts(h.Number)
+	cpy.BaseFee = copyBigInts(h.BaseFee)
+	if h.Extra != nil {
+		cpy.Extra = make([][]byte, len(h.Extra))
+		for i, extra := range h.Extra {
+			if len(extra) > 0 {
+				cpy.Extra[i] = common.CopyBytes(extra)
 			}
 		}
 	}
+	if h.Location != nil {
+		cpy.Location = common.CopyBytes(h.Location)
+	}
 	return &cpy
 }
 
+// copyBigInts creates a deep copy of a list of big integers.
+func copyBigInts(ints []*big.Int) []*big.Int {
+	if ints == nil {
+		return nil
+	}
+	cpy := make([]*big.Int, len(ints))
+	for i, n := range ints {
+		if n != nil {
+			cpy[i] = new(big.Int).Set(n)
+		}
+	}
+	return cpy
+}
+
 // DecodeRLP decodes the Ethereum
 func (b *Block) DecodeRLP(s *rlp.Stream) error {
 	var eb rlpblock
@@ -662,7 +680,9 @@ func (b *Block) BaseFee(params ...int) *big.Int {
 	if len(params) > 0 {
 		context = params[0]
 	}
-
+	if b.header.BaseFee[context] == nil {
+		return nil
+	}
 	return new(big.Int).Set(b.header.BaseFee[context])
 }
 
@@ -561,6 +561,90 @@ func (t *TransactionsByPriceAndNonce) Pop() {
 	heap.Pop(&t.heads)
 }
 
+// TxByTime implements both the sort and the heap interface, ordering transactions
+// by the time they were first seen locally.
+type TxByTime Transactions
+
+func (s TxByTime) Len() int           { return len(s) }
+func (s TxByTime) Less(i, j int) bool { return s[i].time.Before(s[j].time) }
+func (s TxByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s *TxByTime) Push(x interface{}) {
+	*s = append(*s, x.(*Transaction))
+}
+
+func (s *TxByTime) Pop() interface{} {
+	old := *s
+	n := len(old)
+	x := old[n-1]
+	*s = old[0 : n-1]
+	return x
+}
+
+// TransactionsByTimeAndNonce represents a set of transactions that can return
+// transactions in their order of arrival, while honouring the nonce order of
+// every account.
+type TransactionsByTimeAndNonce struct {
+	txs     map[common.Address]Transactions // Per account nonce-sorted list of transactions
+	heads   TxByTime                        // Next transaction for each unique account (arrival heap)
+	signer  Signer                          // Signer for the set of transactions
+	baseFee *big.Int                        // Current base fee
+}
+
+// NewTransactionsByTimeAndNonce creates a transaction set that can retrieve
+// arrival sorted transactions in a nonce-honouring way.
+//
+// Note, the input map is reowned so the caller should not interact any more with
+// if after providing it to the constructor.
+func NewTransactionsByTimeAndNonce(signer Signer, txs map[common.Address]Transactions, baseFee *big.Int) *TransactionsByTimeAndNonce {
+	heads := make(TxByTime, 0, len(txs))
+	for from, accTxs := range txs {
+		acc, _ := Sender(signer, accTxs[0])
+		// Remove transaction if sender doesn't match from, or if it can't pay the base fee.
+		if _, err := accTxs[0].EffectiveGasTip(baseFee); acc != from || err != nil {
+			delete(txs, from)
+			continue
+		}
+		heads = append(heads, accTxs[0])
+		txs[from] = accTxs[1:]
+	}
+	heap.Init(&heads)
+
+	return &TransactionsByTimeAndNonce{
+		txs:     txs,
+		heads:   heads,
+		signer:  signer,
+		baseFee: baseFee,
+	}
+}
+
+// Peek returns the earliest arrived transaction.
+func (t *TransactionsByTimeAndNonce) Peek() *Transaction {
+	if len(t.heads) == 0 {
+		return nil
+	}
+	return t.heads[0]
+}
+
+// Shift replaces the current head with the next one from the same account.
+func (t *TransactionsByTimeAndNonce) Shift() {
+	acc, _ := Sender(t.signer, t.heads[0])
+	if txs, ok := t.txs[acc]; ok && len(txs) > 0 {
+		if _, err := txs[0].EffectiveGasTip(t.baseFee); err == nil {
+			t.heads[0], t.txs[acc] = txs[0], txs[1:]
+			heap.Fix(&t.heads, 0)
+			return
+		}
+	}
+	heap.Pop(&t.heads)
+}
+
+// Pop removes the current head, *not* replacing it with the next one from the
+// same account.
+func (t *TransactionsByTimeAndNonce) Pop() {
+	heap.Pop(&t.heads)
+}
+
 // Message is a fully derived transaction and implements core.Message
 //
 // NOTE: In a future PR this will be removed.
@@ -137,9 +137,11 @@ func (api *PrivateMinerAPI) SetGasLimit(gasLimit hexutil.Uint64) bool {
 }
 
 // SetEtherbase sets the etherbase of the miner
-func (api *PrivateMinerAPI) SetEtherbase(etherbase common.Address) bool {
-	api.e.SetEtherbase(etherbase)
-	return true
+func (api *PrivateMinerAPI) SetEtherbase(etherbase common.Address) (bool, error) {
+	if err := api.e.SetEtherbase(etherbase); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // SetRecommitInterval updates the interval for miner sealing work recommitting.
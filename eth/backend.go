@@ -487,13 +487,17 @@ func (s *Ethereum) shouldPreserve(header *types.Header) bool {
 	return s.isLocalBlock(header)
 }
 
-// SetEtherbase sets the mining reward address.
-func (s *Ethereum) SetEtherbase(etherbase common.Address) {
+// SetEtherbase sets the mining reward address. The address is only retained if
+// the miner accepts it.
+func (s *Ethereum) SetEtherbase(etherbase common.Address) error {
+	if err := s.miner.SetEtherbase(etherbase); err != nil {
+		return err
+	}
 	s.lock.Lock()
 	s.etherbase = etherbase
 	s.lock.Unlock()
 
-	s.miner.SetEtherbase(etherbase)
+	return nil
 }
 
 // StartMining starts the miner with the given number of CPU threads. If mining
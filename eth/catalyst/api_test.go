@@ -238,7 +238,10 @@ func startEthService(t *testing.T, genesis *core.Genesis, blocks []*types.Block)
 		n.Close()
 		t.Fatal("can't import test blocks:", err)
 	}
-	ethservice.SetEtherbase(testAddr)
+	if err := ethservice.SetEtherbase(testAddr); err != nil {
+		n.Close()
+		t.Fatal("can't set etherbase:", err)
+	}
 
 	return n, ethservice
 }
@@ -74,9 +74,10 @@ var Defaults = Config{
 
 	SnapshotCache: 102,
 	Miner: miner.Config{
-		GasCeil:  8000000,
-		GasPrice: big.NewInt(1),
-		Recommit: 3 * time.Second,
+		GasCeil:         8000000,
+		GasPrice:        big.NewInt(1),
+		Recommit:        3 * time.Second,
+		SealEmptyBlocks: true,
 	},
 	TxPool:      core.DefaultTxPoolConfig,
 	RPCGasCap:   50000000,
@@ -52,8 +52,146 @@ type Config struct {
 	GasPrice   *big.Int       // Minimum gas price for mining a transaction
 	Recommit   time.Duration  // The time interval for miner to re-create mining work.
 	Noverify   bool           // Disable remote mining solution verification(only useful in ethash).
+
+	StateRetries    int           // Number of additional attempts to recover a missing sealing state
+	StateRetryDelay time.Duration // Initial delay between state recovery attempts, doubled on every retry
+
+	AllowedCoinbases        []common.Address // Coinbases the miner is permitted to mine to (nil = any)
+	FailOnEmptyPool         bool             // Abort the sealing cycle instead of sealing an empty block if the pool fails
+	MinBaseFee              *big.Int         // Lower bound enforced on the base fee of sealing blocks (nil = none)
+	UncleStaleThreshold     uint64           // Depth at which possible uncle blocks are dropped (0 = default of 7)
+	TaskStaleThreshold      uint64           // Depth at which pending sealing tasks are dropped (0 = default of 7)
+	UncleScanDepth          int              // Number of heights re-scanned in the database for uncle candidates (0 = in-memory only)
+	TxOrdering              string           // Order in which pending transactions are included (price or fifo)
+	IdleStopThreshold       int              // Number of consecutive empty cycles after which sealing stops until transactions arrive (0 = never)
+	UncleRebuildMargin      *big.Int         // Amount by which an uncle reward must exceed the accumulated fees to interrupt sealing (nil = always)
+	AllowDuplicateSealTasks bool             // Pass on sealing tasks with the same seal hash as the previous one instead of skipping them
+	MaxPendingTasks         int              // Maximum number of sealing tasks awaiting a result, the oldest are evicted first (0 = unbounded)
+	MissingParentBackoff    time.Duration    // Maximum delay between retries of sealing cycles failing due to a missing parent (0 = no retries)
+	MaxBlockBytes           uint64           // Cap on the estimated encoded size of the transactions in sealing blocks (0 = unlimited)
+	PreventDoubleSealing    bool             // Refuse to seal a block on top of a parent another worker of the process is already sealing on
+	MaxUncleCandidates      int              // Maximum number of local and of remote uncle candidates to keep (0 = unlimited)
+	PrioritizeCoinbaseTxs   bool             // Include the transactions sent by the coinbase before all others
+	SealEmptyBlocks         bool             // Submit sealing blocks without any transactions for the block reward (enabled by default)
+	MaxNonceGap             uint64           // Skip accounts whose next transaction is further ahead of the state nonce (0 = unlimited)
+	InstantSeal             bool             // Commit a new sealing block on every transaction arrival instead of periodically
+	MaxExternalGasFactor    uint64           // Cap on the external gas used counted in gas limit adjustments, as a multiple of the parent gas limit (0 = unlimited)
+	SpeculativePrefetch     bool             // Warm up the state of pending transactions' accounts in the background while filling blocks
+	PrepareFailureThreshold int              // Number of consecutive engine preparation failures to raise an alert at (0 = never)
+	StopOnPrepareFailure    bool             // Stop sealing once the preparation failure threshold is reached
+	MinCommitInterval       time.Duration    // Minimum time between sealing work commits, faster requests are coalesced (0 = unthrottled)
+
+	RetainTemplatesWhenStopped bool          // Assemble and keep the pending block even if sealing is stopped
+	RefillDuringCommit         bool          // Re-query the pending transactions partway through filling a block, merging in new arrivals
+	GasLimitUncleWindow        int           // Number of blocks whose uncles are counted when adjusting the gas limit (0 = default of 1000)
+	MaxTaskAge                 time.Duration // Age at which sealing tasks not yet picked up for sealing are dropped (0 = never)
+	AllowPendingReplacement    bool          // Swap transactions in the pending block for same nonce ones with a higher tip while not sealing
+	MaxGasLimitDelta           uint64        // Maximum change of the gas limit from the parent per block (0 = consensus bound only)
+	ExcludeSelfUncles          bool          // Skip uncle candidates mined by the local miner
+	AssemblyFailureThreshold   int           // Number of consecutive assembly failures on a parent to pause sealing on it at (0 = never)
+	MinUncleAge                uint64        // Minimum number of blocks an uncle must lie below the sealing block to be included
+}
+
+// WorkerStatus is a snapshot of the operational state of the miner.
+type WorkerStatus struct {
+	Running  bool           // Whether the consensus engine is sealing blocks
+	Preseal  bool           // Whether empty blocks are sealed in advance
+	Coinbase common.Address // Address receiving the mining rewards
+}
+
+// TxPoolFailure describes a failure to retrieve the pending transactions from the
+// transaction pool.
+type TxPoolFailure struct {
+	Err error // Error returned by the transaction pool
+}
+
+// PrepareFailure describes a failure of the consensus engine to prepare a sealing
+// block header.
+type PrepareFailure struct {
+	Err error // Error returned by the consensus engine
+}
+
+// UncleRejection describes an uncle candidate which could not be included in the
+// sealing block.
+type UncleRejection struct {
+	Hash   common.Hash // Hash of the rejected uncle
+	Reason string      // Reason the uncle was rejected for
+}
+
+// AssemblyFailure is the alert raised when sealing blocks on top of a parent
+// repeatedly failed to assemble.
+type AssemblyFailure struct {
+	Parent   common.Hash // Parent the sealing blocks were built on
+	Failures int         // Number of consecutive failures
+	Err      error       // Error of the last failure
+}
+
+// TxFee is the fee paid to the miner by a single transaction of the pending block.
+type TxFee struct {
+	Hash         common.Hash // Hash of the transaction
+	GasUsed      uint64      // Gas consumed by the transaction
+	EffectiveTip *big.Int    // Tip paid per unit of gas on top of the base fee
+	TotalFee     *big.Int    // Total tip paid to the miner
+}
+
+// SealRequirements describes what a sealing solution submitted by an external
+// sealer must contain to be accepted.
+type SealRequirements struct {
+	Noverify      bool     // Whether submitted solutions are accepted without verification
+	AlgorithmName string   // Name of the sealing algorithm of the consensus engine
+	HeaderFields  []string // Header fields the solution has to fill in
+}
+
+// ConfigPatch is a set of worker configuration changes applied atomically. Nil
+// fields are left unchanged.
+type ConfigPatch struct {
+	Coinbase *common.Address // Address to credit the block rewards to
+	Extra    []byte          // Content of the block extra field
+	GasCeil  *uint64         // Gas limit to strive for when mining blocks
+	Recommit *time.Duration  // Interval for sealing work resubmitting
+}
+
+// TxFilter decides whether a transaction from the given sender is eligible for
+// inclusion in the sealing block.
+type TxFilter func(tx *types.Transaction, from common.Address) bool
+
+// TxReadyFunc decides whether a transaction may be included in a block with the
+// given timestamp, or has to be deferred to a later block.
+type TxReadyFunc func(tx *types.Transaction, blockTime uint64) bool
+
+// TxDeadlineFunc returns the latest block timestamp a transaction may still be
+// included at, or false if the transaction carries no deadline.
+type TxDeadlineFunc func(tx *types.Transaction) (uint64, bool)
+
+// BlockFillResult describes why filling the sealing block with transactions ended.
+type BlockFillResult struct {
+	Reason string // Condition which closed the block (one of the FillReason constants)
 }
 
+const (
+	// TxOrderingPrice includes pending transactions by effective tip, honouring
+	// the nonce order of every account.
+	TxOrderingPrice = "price"
+
+	// TxOrderingFIFO includes pending transactions in the order they arrived
+	// locally, honouring the nonce order of every account.
+	TxOrderingFIFO = "fifo"
+
+	// FillReasonGas reports that the block ran out of gas for further transactions.
+	FillReasonGas = "gas"
+
+	// FillReasonBytes reports that the next transaction exceeded the block byte
+	// size cap.
+	FillReasonBytes = "bytes"
+
+	// FillReasonPoolEmpty reports that all pending transactions were considered.
+	FillReasonPoolEmpty = "pool-empty"
+
+	// FillReasonInterrupt reports that filling was interrupted by a new sealing
+	// cycle.
+	FillReasonInterrupt = "interrupt"
+)
+
 // Miner creates blocks and searches for proof-of-work values.
 type Miner struct {
 	mux      *event.TypeMux
@@ -117,20 +255,29 @@ func (miner *Miner) update() {
 			case downloader.FailedEvent:
 				canStart = true
 				if shouldStart {
-					miner.SetEtherbase(miner.coinbase)
-					miner.worker.start()
+					if err := miner.SetEtherbase(miner.coinbase); err != nil {
+						log.Error("Failed to resume mining", "coinbase", miner.coinbase, "err", err)
+					} else {
+						miner.worker.start()
+					}
 				}
 			case downloader.DoneEvent:
 				canStart = true
 				if shouldStart {
-					miner.SetEtherbase(miner.coinbase)
-					miner.worker.start()
+					if err := miner.SetEtherbase(miner.coinbase); err != nil {
+						log.Error("Failed to resume mining", "coinbase", miner.coinbase, "err", err)
+					} else {
+						miner.worker.start()
+					}
 				}
 				// Stop reacting to downloader events
 				events.Unsubscribe()
 			}
 		case addr := <-miner.startCh:
-			miner.SetEtherbase(addr)
+			if err := miner.SetEtherbase(addr); err != nil {
+				log.Error("Failed to start mining", "coinbase", addr, "err", err)
+				continue
+			}
 			if canStart {
 				miner.worker.start()
 			}
@@ -161,6 +308,11 @@ func (miner *Miner) Mining() bool {
 	return miner.worker.isRunning()
 }
 
+// Status returns the current operational state of the miner.
+func (miner *Miner) Status() WorkerStatus {
+	return miner.worker.status()
+}
+
 func (miner *Miner) Hashrate() uint64 {
 	if pow, ok := miner.engine.(consensus.PoW); ok {
 		return uint64(pow.Hashrate())
@@ -176,11 +328,62 @@ func (miner *Miner) SetExtra(extra []byte) error {
 	return nil
 }
 
+// Extra returns the extra data included in mined blocks.
+func (miner *Miner) Extra() []byte {
+	return miner.worker.getExtra()
+}
+
+// SetTxFilter sets a custom policy deciding which transactions are eligible for
+// inclusion in mined blocks. It is consulted before the built-in policies, a nil
+// filter accepts any transaction.
+func (miner *Miner) SetTxFilter(filter TxFilter) {
+	miner.worker.setTxFilter(filter)
+}
+
+// SetTxReadyFunc sets a custom policy deferring transactions which are not yet
+// ready for inclusion at the timestamp of the sealing block. A nil function
+// considers every transaction ready.
+func (miner *Miner) SetTxReadyFunc(ready TxReadyFunc) {
+	miner.worker.setTxReadyFunc(ready)
+}
+
+// SetTxDeadlineFunc sets a custom policy excluding transactions whose deadline
+// precedes the timestamp of the sealing block. A nil function considers no
+// transaction expired.
+func (miner *Miner) SetTxDeadlineFunc(deadline TxDeadlineFunc) {
+	miner.worker.setTxDeadlineFunc(deadline)
+}
+
+// ApplyConfig validates and applies all changes of the given patch at once. If
+// any change is invalid, an error is returned and none of them is applied.
+func (miner *Miner) ApplyConfig(patch ConfigPatch) error {
+	if err := miner.worker.applyConfig(patch); err != nil {
+		return err
+	}
+	if patch.Coinbase != nil {
+		miner.coinbase = *patch.Coinbase
+	}
+	return nil
+}
+
+// SetSealResultHandler sets a callback receiving every sealed block instead of
+// the default processing, leaving the decision to insert and broadcast it to
+// the caller. A nil handler restores the default processing.
+func (miner *Miner) SetSealResultHandler(handler func(block *types.Block)) {
+	miner.worker.setSealResultHandler(handler)
+}
+
 // SetRecommitInterval sets the interval for sealing work resubmitting.
 func (miner *Miner) SetRecommitInterval(interval time.Duration) {
 	miner.worker.setRecommitInterval(interval)
 }
 
+// SeedPending builds the initial pending block and state on top of the current
+// head without starting to mine, e.g. for a miner created without it.
+func (miner *Miner) SeedPending() {
+	miner.worker.seedPending()
+}
+
 // Pending returns the currently pending block and associated state.
 func (miner *Miner) Pending() (*types.Block, *state.StateDB) {
 	return miner.worker.pending()
@@ -195,14 +398,137 @@ func (miner *Miner) PendingBlock() *types.Block {
 	return miner.worker.pendingBlock()
 }
 
+// PendingComputedRoot returns the state root the currently pending block commits
+// to once assembled.
+func (miner *Miner) PendingComputedRoot() (common.Hash, error) {
+	return miner.worker.pendingComputedRoot()
+}
+
+// CurrentSealingHeader returns the header of the current sealing block before it
+// is assembled, or false if there is no sealing block yet.
+func (miner *Miner) CurrentSealingHeader() (*types.Header, bool) {
+	return miner.worker.currentSealingHeader()
+}
+
+// PendingTransactions returns the transactions of the currently pending block.
+func (miner *Miner) PendingTransactions() types.Transactions {
+	return miner.worker.pendingBlockTransactions()
+}
+
 // PendingBlockAndReceipts returns the currently pending block and corresponding receipts.
 func (miner *Miner) PendingBlockAndReceipts() (*types.Block, types.Receipts) {
 	return miner.worker.pendingBlockAndReceipts()
 }
 
-func (miner *Miner) SetEtherbase(addr common.Address) {
+// PendingFeeBreakdown returns the fees paid to the miner by every transaction of
+// the pending block, or nil if there is no pending block.
+func (miner *Miner) PendingFeeBreakdown() []TxFee {
+	return miner.worker.pendingFeeBreakdown()
+}
+
+// HighestFeeTx returns the transaction of the pending block paying the largest
+// total tip to the miner along with that tip, or false if there is none.
+func (miner *Miner) HighestFeeTx() (*types.Transaction, *big.Int, bool) {
+	return miner.worker.highestFeeTx()
+}
+
+// OrphanedLocalBlocks returns the hashes of the blocks mined by this node within
+// the given number of blocks below the chain head which were neither made
+// canonical nor included as uncles.
+func (miner *Miner) OrphanedLocalBlocks(window uint64) []common.Hash {
+	return miner.worker.orphanedLocalBlocks(window)
+}
+
+// SealingRequirements returns what a sealing solution must contain to be
+// accepted by the configured consensus engine.
+func (miner *Miner) SealingRequirements() SealRequirements {
+	return miner.worker.sealingRequirements()
+}
+
+// PendingUncleHashes returns the hashes of the uncles included in the pending block.
+func (miner *Miner) PendingUncleHashes() []common.Hash {
+	return miner.worker.pendingUncleHashes()
+}
+
+// PendingUncleCount returns the number of uncles included in the pending block.
+func (miner *Miner) PendingUncleCount() int {
+	return miner.worker.pendingUncleCount()
+}
+
+// PendingUncleRewards returns the rewards credited to the coinbases of the uncles
+// included in the pending block.
+func (miner *Miner) PendingUncleRewards() map[common.Address]*big.Int {
+	return miner.worker.pendingUncleRewards()
+}
+
+// EffectiveTip returns the miner tip the given transaction would pay against the
+// base fee of the pending block.
+func (miner *Miner) EffectiveTip(tx *types.Transaction) (*big.Int, error) {
+	return miner.worker.effectiveTip(tx)
+}
+
+// PendingNonce returns the next nonce of the given account, accounting for the
+// transactions already included in the pending block.
+func (miner *Miner) PendingNonce(addr common.Address) uint64 {
+	return miner.worker.pendingNonce(addr)
+}
+
+// PendingTxFeeStats returns the minimum, median and maximum effective miner tip
+// of the transactions in the pending block, or false if there are none.
+func (miner *Miner) PendingTxFeeStats() (min, median, max *big.Int, ok bool) {
+	return miner.worker.pendingTxFeeStats()
+}
+
+// LastFillResult reports why filling the last pending block with transactions
+// ended.
+func (miner *Miner) LastFillResult() BlockFillResult {
+	return miner.worker.lastFillResult()
+}
+
+// LastDroppedTxs returns the hashes of the transactions which failed with an
+// unexpected error while assembling the last pending block, so that they can
+// be removed from the transaction pool.
+func (miner *Miner) LastDroppedTxs() []common.Hash {
+	return miner.worker.lastDroppedTxs()
+}
+
+// CommitBundle applies the given transactions to the pending block atomically:
+// either all of them are included in order, or none of them if any fails.
+func (miner *Miner) CommitBundle(txs types.Transactions) error {
+	return miner.worker.submitBundle(txs)
+}
+
+// RefreshBaseFee recomputes the base fee of the pending block, e.g. after the
+// minimum base fee has been changed.
+func (miner *Miner) RefreshBaseFee() {
+	miner.worker.refreshBaseFee()
+}
+
+// RemainingGas returns the gas left in the block currently being sealed. The
+// flag is false if no sealing block is available.
+func (miner *Miner) RemainingGas() (uint64, bool) {
+	return miner.worker.remainingGas()
+}
+
+// SetEtherbase sets the mining reward address. It returns an error if the
+// address is not in the configured set of allowed coinbases.
+func (miner *Miner) SetEtherbase(addr common.Address) error {
+	if err := miner.worker.setEtherbase(addr); err != nil {
+		return err
+	}
 	miner.coinbase = addr
-	miner.worker.setEtherbase(addr)
+	return nil
+}
+
+// Coinbase returns the address the worker currently credits the mining rewards to.
+func (miner *Miner) Coinbase() common.Address {
+	return miner.worker.getCoinbase()
+}
+
+// ValidateCoinbase checks whether the given address would currently be accepted
+// as the coinbase of mined blocks, returning a descriptive error if not.
+func (miner *Miner) ValidateCoinbase(addr common.Address) error {
+	return miner.worker.validateCoinbase(addr)
 }
 
 // SetGasCeil sets the gaslimit to strive for when mining blocks post 1559.
@@ -234,11 +560,121 @@ func (miner *Miner) SubscribePendingLogs(ch chan<- []*types.Log) event.Subscript
 	return miner.worker.pendingLogsFeed.Subscribe(ch)
 }
 
+// SubscribeFilteredLogs starts delivering the logs of pending transactions and
+// newly mined blocks to the given channel, limited to those emitted by any of
+// the given addresses and matching the given topics. An empty address list or
+// topic position matches everything.
+func (miner *Miner) SubscribeFilteredLogs(addresses []common.Address, topics [][]common.Hash, ch chan<- []*types.Log) event.Subscription {
+	var (
+		pendingCh  = make(chan []*types.Log, logsChanSize)
+		minedCh    = make(chan []*types.Log, logsChanSize)
+		pendingSub = miner.worker.pendingLogsFeed.Subscribe(pendingCh)
+		minedSub   = miner.worker.chain.SubscribeLogsEvent(minedCh)
+	)
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer pendingSub.Unsubscribe()
+		defer minedSub.Unsubscribe()
+
+		for {
+			var logs []*types.Log
+			select {
+			case logs = <-pendingCh:
+			case logs = <-minedCh:
+			case err := <-pendingSub.Err():
+				return err
+			case err := <-minedSub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+			if matched := filterLogs(logs, addresses, topics); len(matched) > 0 {
+				select {
+				case ch <- matched:
+				case <-quit:
+					return nil
+				}
+			}
+		}
+	})
+}
+
+// filterLogs returns the logs emitted by any of the given addresses and matching
+// the given topics.
+func filterLogs(logs []*types.Log, addresses []common.Address, topics [][]common.Hash) []*types.Log {
+	var matched []*types.Log
+Logs:
+	for _, l := range logs {
+		if len(addresses) > 0 && !includes(addresses, l.Address) {
+			continue
+		}
+		if len(topics) > len(l.Topics) {
+			continue
+		}
+		for i, sub := range topics {
+			if len(sub) > 0 && !includesHash(sub, l.Topics[i]) {
+				continue Logs
+			}
+		}
+		matched = append(matched, l)
+	}
+	return matched
+}
+
+func includes(addresses []common.Address, a common.Address) bool {
+	for _, addr := range addresses {
+		if addr == a {
+			return true
+		}
+	}
+	return false
+}
+
+func includesHash(hashes []common.Hash, h common.Hash) bool {
+	for _, hash := range hashes {
+		if hash == h {
+			return true
+		}
+	}
+	return false
+}
+
 // SubscribePendingBlock starts delivering the pending block to the given channel.
 func (miner *Miner) SubscribePendingBlock(ch chan<- *types.Header) event.Subscription {
 	return miner.worker.pendingBlockFeed.Subscribe(ch)
 }
 
+// SubscribeMinedBlocks starts delivering the blocks sealed by this miner to the
+// given channel. Contrary to chain head events, only locally sealed blocks are
+// delivered.
+func (miner *Miner) SubscribeMinedBlocks(ch chan<- *types.Block) event.Subscription {
+	return miner.worker.minedBlockFeed.Subscribe(ch)
+}
+
+// SubscribeTxPoolErrors starts delivering the failures encountered while retrieving
+// pending transactions from the transaction pool to the given channel.
+func (miner *Miner) SubscribeTxPoolErrors(ch chan<- TxPoolFailure) event.Subscription {
+	return miner.worker.txPoolErrFeed.Subscribe(ch)
+}
+
+// SubscribePrepareErrors starts delivering the failures of the consensus engine
+// to prepare sealing block headers to the given channel.
+func (miner *Miner) SubscribePrepareErrors(ch chan<- PrepareFailure) event.Subscription {
+	return miner.worker.prepareErrFeed.Subscribe(ch)
+}
+
+// SubscribeUncleRejections starts delivering the uncle candidates rejected for
+// inclusion in the sealing block to the given channel.
+func (miner *Miner) SubscribeUncleRejections(ch chan<- UncleRejection) event.Subscription {
+	return miner.worker.uncleRejectedFeed.Subscribe(ch)
+}
+
+// SubscribeAssemblyFailures starts delivering an alert to the given channel
+// whenever sealing on top of a parent is paused due to repeated failures to
+// assemble the block. Sealing resumes once the chain head changes.
+func (miner *Miner) SubscribeAssemblyFailures(ch chan<- AssemblyFailure) event.Subscription {
+	return miner.worker.assemblyFailFeed.Subscribe(ch)
+}
+
 // Method to retrieve uncles from the worker in case not found in normal DB.
 func (miner *Miner) GetUncle(hash common.Hash) *types.Block {
 	if uncle, exist := miner.worker.localUncles[hash]; exist {
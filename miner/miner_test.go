@@ -19,11 +19,12 @@ package miner
 
 import (
 	"errors"
+	"math/big"
 	"testing"
 	"time"
 
 	"github.com/spruce-solutions/go-quai/common"
-	"github.com/spruce-solutions/go-quai/consensus/clique"
+	"github.com/spruce-solutions/go-quai/consensus/blake3"
 	"github.com/spruce-solutions/go-quai/core"
 	"github.com/spruce-solutions/go-quai/core/rawdb"
 	"github.com/spruce-solutions/go-quai/core/state"
@@ -66,9 +67,12 @@ type testBlockChain struct {
 }
 
 func (bc *testBlockChain) CurrentBlock() *types.Block {
-	return types.NewBlock(&types.Header{
-		GasLimit: []uint64{bc.gasLimit},
-	}, nil, nil, nil, trie.NewStackTrie(nil))
+	header := types.NewEmptyHeader()
+	for i := range header.GasLimit {
+		header.Number[i] = new(big.Int)
+		header.GasLimit[i] = bc.gasLimit
+	}
+	return types.NewBlock(header, nil, nil, nil, trie.NewStackTrie(nil))
 }
 
 func (bc *testBlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
@@ -85,7 +89,7 @@ func (bc *testBlockChain) GetGasUsedInChain(block *types.Block, length int) int6
 }
 
 func (bc *testBlockChain) GetHeaderByNumber(number uint64) *types.Header {
-	return bc.GetHeaderByNumber(number)
+	return bc.CurrentBlock().Header()
 }
 
 func (bc *testBlockChain) GetUnclesInChain(block *types.Block, length int) []*types.Header {
@@ -240,6 +244,61 @@ func TestMinerSetEtherbase(t *testing.T) {
 	}
 }
 
+// Tests that mining isn't started with a coinbase the miner rejects.
+func TestMinerRejectedEtherbase(t *testing.T) {
+	miner, _ := createMiner(t)
+	defer miner.Close()
+
+	miner.worker.config.AllowedCoinbases = []common.Address{common.HexToAddress("0x1337")}
+	if err := miner.SetEtherbase(common.HexToAddress("0xdead")); err == nil {
+		t.Fatalf("disallowed etherbase accepted")
+	}
+	miner.Start(common.HexToAddress("0xdead"))
+	waitForMiningState(t, miner, false)
+
+	miner.Start(common.HexToAddress("0x1337"))
+	waitForMiningState(t, miner, true)
+	if got, exp := miner.coinbase, common.HexToAddress("0x1337"); got != exp {
+		t.Fatalf("Wrong coinbase, got %x expected %x", got, exp)
+	}
+}
+
+// Tests that filtered log subscriptions only deliver the matching logs.
+func TestSubscribeFilteredLogs(t *testing.T) {
+	miner, _ := createMiner(t)
+	defer miner.Close()
+
+	var (
+		wanted = common.HexToAddress("0x1111")
+		other  = common.HexToAddress("0x2222")
+		topic  = common.HexToHash("0x01")
+	)
+	logs := make(chan []*types.Log, 1)
+	sub := miner.SubscribeFilteredLogs([]common.Address{wanted}, [][]common.Hash{{topic}}, logs)
+	defer sub.Unsubscribe()
+
+	miner.worker.pendingLogsFeed.Send([]*types.Log{
+		{Address: other, Topics: []common.Hash{topic}},
+		{Address: wanted, Topics: []common.Hash{topic}},
+		{Address: wanted, Topics: []common.Hash{common.HexToHash("0x02")}},
+		{Address: other, Topics: []common.Hash{topic}},
+	})
+	select {
+	case have := <-logs:
+		if len(have) != 1 || have[0].Address != wanted || have[0].Topics[0] != topic {
+			t.Fatalf("filtered logs mismatch: have %v", have)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("filtered logs not delivered")
+	}
+	miner.worker.pendingLogsFeed.Send([]*types.Log{{Address: other, Topics: []common.Hash{topic}}})
+	select {
+	case have := <-logs:
+		t.Errorf("unexpected logs delivered: %v", have)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
 // waitForMiningState waits until either
 // * the desired mining state was reached
 // * a timeout was reached which fails the test
@@ -264,15 +323,15 @@ func createMiner(t *testing.T) (*Miner, *event.TypeMux) {
 	// Create chainConfig
 	memdb := memorydb.New()
 	chainDB := rawdb.NewDatabase(memdb)
-	genesis := core.DeveloperGenesisBlock(15, common.HexToAddress("12345"))
+	genesis := &core.Genesis{Config: ethashChainConfig}
 	chainConfig, _, err := core.SetupGenesisBlock(chainDB, genesis)
 	if err != nil {
 		t.Fatalf("can't create new chain config: %v", err)
 	}
 	// Create consensus engine
-	engine := clique.New(chainConfig.Clique, chainDB)
+	engine := blake3.NewFaker()
 	// Create Ethereum backend
-	bc, err := core.NewBlockChain(chainDB, nil, chainConfig, engine, vm.Config{}, nil, nil)
+	bc, err := core.NewBlockChain(chainDB, nil, chainConfig, "", nil, engine, vm.Config{}, nil, nil)
 	if err != nil {
 		t.Fatalf("can't create new chain %v", err)
 	}
@@ -0,0 +1,68 @@
+package miner
+
+import (
+	"sync"
+
+	"github.com/spruce-solutions/go-quai/common"
+)
+
+// sharedSealGuard is the seal guard shared by all workers of the process, so
+// that the workers of different contexts running side by side don't compete.
+var sharedSealGuard = newSealGuard()
+
+// sealTarget identifies the block being sealed by the context it is sealed in
+// and the parent it is built on top of.
+type sealTarget struct {
+	context int
+	parent  common.Hash
+}
+
+// sealGuard tracks the blocks being sealed by the workers of all contexts,
+// refusing to seal a second block on top of the same parent in the same context
+// to prevent the miner from competing with itself.
+//
+// A worker holds at most one target per context. It is released when the worker
+// acquires a new target in the same context, and all targets of a worker are
+// released when it is stopped or closed.
+type sealGuard struct {
+	owners map[sealTarget]interface{} // Worker currently sealing the given target
+	lock   sync.Mutex                 // Protects the owners from concurrent access
+}
+
+// newSealGuard returns a new, empty seal guard.
+func newSealGuard() *sealGuard {
+	return &sealGuard{
+		owners: make(map[sealTarget]interface{}),
+	}
+}
+
+// acquire records the given owner as sealing the target, releasing any other
+// target of the owner in the same context. It returns false if the target is
+// already being sealed by another owner.
+func (g *sealGuard) acquire(target sealTarget, owner interface{}) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if current, ok := g.owners[target]; ok && current != owner {
+		return false
+	}
+	for held, current := range g.owners {
+		if current == owner && held.context == target.context {
+			delete(g.owners, held)
+		}
+	}
+	g.owners[target] = owner
+	return true
+}
+
+// release removes all targets held by the given owner from the guard.
+func (g *sealGuard) release(owner interface{}) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for target, current := range g.owners {
+		if current == owner {
+			delete(g.owners, target)
+		}
+	}
+}
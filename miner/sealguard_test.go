@@ -0,0 +1,94 @@
+package miner
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/spruce-solutions/go-quai/common"
+	"github.com/spruce-solutions/go-quai/consensus/blake3"
+	"github.com/spruce-solutions/go-quai/core/rawdb"
+	"github.com/spruce-solutions/go-quai/core/types"
+)
+
+// Tests that concurrent attempts to seal on top of the same parent in the same
+// context are refused for all but one sealer.
+func TestSealGuardConcurrent(t *testing.T) {
+	var (
+		guard    = newSealGuard()
+		target   = sealTarget{context: 0, parent: common.Hash{0x01}}
+		acquired = make([]bool, 2)
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < len(acquired); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			acquired[i] = guard.acquire(target, i)
+		}(i)
+	}
+	wg.Wait()
+
+	if acquired[0] == acquired[1] {
+		t.Fatalf("acquisition mismatch: have %v, want exactly one", acquired)
+	}
+	owner := 0
+	if acquired[1] {
+		owner = 1
+	}
+	// The owner may reacquire, others only after release
+	if !guard.acquire(target, owner) {
+		t.Errorf("owner failed to reacquire target")
+	}
+	if guard.acquire(target, 1-owner) {
+		t.Errorf("non-owner acquired held target")
+	}
+	guard.release(1 - owner)
+	if guard.acquire(target, 1-owner) {
+		t.Errorf("non-owner released held target")
+	}
+	guard.release(owner)
+	if !guard.acquire(target, 1-owner) {
+		t.Errorf("target not acquirable after release")
+	}
+	// Other contexts are unaffected, moving to another parent frees the old one
+	if !guard.acquire(sealTarget{context: 1, parent: target.parent}, owner) {
+		t.Errorf("target in other context refused")
+	}
+	if !guard.acquire(sealTarget{context: 0, parent: common.Hash{0x02}}, 1-owner) {
+		t.Errorf("target with other parent refused")
+	}
+	if !guard.acquire(target, owner) {
+		t.Errorf("target not acquirable after owner moved on")
+	}
+}
+
+// Tests that stopping or closing a worker releases the targets it holds in the
+// seal guard.
+func TestSealGuardRelease(t *testing.T) {
+	engine := blake3.NewFaker()
+	defer engine.Close()
+
+	w, _ := newTestWorker(t, testConfig, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	w.sealGuard = newSealGuard()
+
+	var (
+		target = sealTarget{context: types.QuaiNetworkContext, parent: common.Hash{0x01}}
+		other  = "other"
+	)
+	if !w.sealGuard.acquire(target, w) {
+		t.Fatalf("worker failed to acquire target")
+	}
+	w.stop()
+	if !w.sealGuard.acquire(target, other) {
+		t.Fatalf("target still held after stopping the worker")
+	}
+	w.sealGuard.release(other)
+
+	if !w.sealGuard.acquire(target, w) {
+		t.Fatalf("worker failed to reacquire target")
+	}
+	w.close()
+	if !w.sealGuard.acquire(target, other) {
+		t.Errorf("target still held after closing the worker")
+	}
+}
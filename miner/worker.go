@@ -1,9 +1,11 @@
 package miner
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math/big"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -35,6 +37,9 @@ const (
 	// chainSideChanSize is the size of channel listening to ChainSideEvent.
 	chainSideChanSize = 10
 
+	// logsChanSize is the size of channel listening to pending and mined logs.
+	logsChanSize = 10
+
 	// resubmitAdjustChanSize is the size of resubmitting interval adjustment channel.
 	resubmitAdjustChanSize = 10
 
@@ -57,8 +62,38 @@ const (
 	// increasing upper limit or decreasing lower limit so that the limit can be reachable.
 	intervalAdjustBias = 200 * 1000.0 * 1000.0
 
-	// staleThreshold is the maximum depth of the acceptable stale block.
+	// staleThreshold is the default maximum depth of the acceptable stale block.
 	staleThreshold = 7
+
+	// gasLimitUncleWindow is the default number of blocks whose uncles are counted
+	// when adjusting the gas limit.
+	gasLimitUncleWindow = 1000
+
+	// refillGasDivisor is the fraction of the block gas limit that must still be
+	// available for the pending transactions to be re-queried during a fill.
+	refillGasDivisor = 4
+)
+
+var (
+	// errNoCoinbase is returned if sealing is attempted without a coinbase to
+	// credit the rewards to.
+	errNoCoinbase = errors.New("refusing to mine without etherbase")
+
+	// errCoinbaseNotAllowed is returned if the coinbase to mine to is not in the
+	// configured set of allowed coinbases.
+	errCoinbaseNotAllowed = errors.New("coinbase not allowed")
+
+	// errMissingParent is returned if the parent to build the sealing block on
+	// top of is not available.
+	errMissingParent = errors.New("missing parent")
+
+	// errSealBusy is returned if another worker is already sealing a block on
+	// top of the same parent in the same context.
+	errSealBusy = errors.New("competing block already being sealed")
+
+	// errNoPendingBlock is returned if an operation requires the pending block,
+	// but none has been assembled yet.
+	errNoPendingBlock = errors.New("no pending block available")
 )
 
 // environment is the worker's current environment and holds all
@@ -77,6 +112,9 @@ type environment struct {
 	txs                 []*types.Transaction
 	receipts            []*types.Receipt
 	uncles              map[common.Hash]*types.Header
+	droppedTxs          []common.Hash // transactions which returned errors so they can be removed
+	fillResult          BlockFillResult
+	refilled            bool // whether the pending transactions were re-queried during the fill
 	externalGasUsed     uint64
 	externalBlockLength int
 }
@@ -105,6 +143,9 @@ func (env *environment) copy() *environment {
 	for hash, uncle := range env.uncles {
 		cpy.uncles[hash] = uncle
 	}
+	cpy.droppedTxs = make([]common.Hash, len(env.droppedTxs))
+	copy(cpy.droppedTxs, env.droppedTxs)
+	cpy.fillResult = env.fillResult
 	return cpy
 }
 
@@ -155,6 +196,21 @@ type getWorkReq struct {
 	result chan *types.Block
 }
 
+// bundleReq represents a request for committing a transaction bundle atomically
+// into the current sealing block.
+type bundleReq struct {
+	txs    types.Transactions
+	result chan error
+}
+
+// txIterator is a nonce-honouring iterator over the transactions to be committed
+// into a sealing block.
+type txIterator interface {
+	Peek() *types.Transaction
+	Shift()
+	Pop()
+}
+
 // intervalAdjust represents a resubmitting interval adjustment.
 type intervalAdjust struct {
 	ratio float64
@@ -171,8 +227,13 @@ type worker struct {
 	chain       *core.BlockChain
 
 	// Feeds
-	pendingLogsFeed  event.Feed
-	pendingBlockFeed event.Feed
+	pendingLogsFeed   event.Feed
+	pendingBlockFeed  event.Feed
+	minedBlockFeed    event.Feed
+	txPoolErrFeed     event.Feed
+	prepareErrFeed    event.Feed
+	uncleRejectedFeed event.Feed
+	assemblyFailFeed  event.Feed
 
 	// Subscriptions
 	mux          *event.TypeMux
@@ -186,6 +247,9 @@ type worker struct {
 	// Channels
 	newWorkCh          chan *newWorkReq
 	getWorkCh          chan *getWorkReq
+	bundleCh           chan *bundleReq
+	baseFeeCh          chan chan struct{}
+	gasPoolCh          chan chan *core.GasPool
 	taskCh             chan *task
 	resultCh           chan *types.Block
 	startCh            chan struct{}
@@ -199,10 +263,18 @@ type worker struct {
 	localUncles  map[common.Hash]*types.Block // A set of side blocks generated locally as the possible uncle blocks.
 	remoteUncles map[common.Hash]*types.Block // A set of side blocks as the possible uncle blocks.
 	unconfirmed  *unconfirmedBlocks           // A set of locally mined blocks pending canonicalness confirmations.
+	sealGuard    *sealGuard                   // Guard against sealing competing blocks across workers.
+
+	assemblyParent common.Hash // Parent of the sealing blocks which failed to assemble most recently.
+	assemblyMiss   int         // Number of consecutive assembly failures on top of assemblyParent.
 
-	mu       sync.RWMutex // The lock used to protect the coinbase and extra fields
-	coinbase common.Address
-	extra    []byte
+	mu           sync.RWMutex // The lock used to protect the coinbase, extra, txFilter, txReady, txDeadline and onSealResult fields
+	coinbase     common.Address
+	extra        []byte
+	txFilter     TxFilter
+	txReady      TxReadyFunc
+	txDeadline   TxDeadlineFunc
+	onSealResult func(block *types.Block)
 
 	pendingMu    sync.RWMutex
 	pendingTasks map[common.Hash]*task
@@ -211,10 +283,18 @@ type worker struct {
 	snapshotBlock    *types.Block
 	snapshotReceipts types.Receipts
 	snapshotState    *state.StateDB
+	snapshotDropped  []common.Hash
+	snapshotFill     BlockFillResult
+	snapshotHeader   *types.Header
 
 	// atomic status counters
-	running int32 // The indicator whether the consensus engine is running or not.
-	newTxs  int32 // New arrival transaction count since last sealing work submitting.
+	running     int32 // The indicator whether the consensus engine is running or not.
+	newTxs      int32 // New arrival transaction count since last sealing work submitting.
+	idleCycles  int32 // Number of consecutive sealing cycles without any transactions.
+	idleStopped int32 // The indicator whether sealing was stopped due to idleness.
+	parentMiss  int32 // Number of consecutive sealing cycles which failed due to a missing parent.
+	lostAdjusts int32 // Number of resubmit interval adjustments dropped as the work loop was busy.
+	prepareMiss int32 // Number of consecutive sealing cycles which failed in the engine preparation.
 
 	// noempty is the flag used to control whether the feature of pre-seal empty
 	// block is enabled. The default value is false(pre-seal is enabled by default).
@@ -227,10 +307,14 @@ type worker struct {
 	isLocalBlock func(header *types.Header) bool // Function used to determine whether the specified block is mined by local miner.
 
 	// Test hooks
-	newTaskHook  func(*task)                        // Method to call upon receiving a new sealing task.
-	skipSealHook func(*task) bool                   // Method to decide whether skipping the sealing.
-	fullTaskHook func()                             // Method to call before pushing the full sealing task.
-	resubmitHook func(time.Duration, time.Duration) // Method to call upon updating resubmitting interval.
+	newTaskHook  func(*task)                                           // Method to call upon receiving a new sealing task.
+	skipSealHook func(*task) bool                                      // Method to decide whether skipping the sealing.
+	fullTaskHook func()                                                // Method to call before pushing the full sealing task.
+	resubmitHook func(time.Duration, time.Duration)                    // Method to call upon updating resubmitting interval.
+	pendingHook  func() (map[common.Address]types.Transactions, error) // Method to call instead of retrieving the pool's pending transactions.
+	headHook     func() *types.Block                                   // Method to call instead of retrieving the chain's current block.
+
+	signerOverride types.Signer // Signer to use instead of the one derived from the chain config, only used in testing.
 }
 
 func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus.Engine, eth Backend, mux *event.TypeMux, isLocalBlock func(header *types.Header) bool, init bool) *worker {
@@ -245,12 +329,16 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		localUncles:        make(map[common.Hash]*types.Block),
 		remoteUncles:       make(map[common.Hash]*types.Block),
 		unconfirmed:        newUnconfirmedBlocks(eth.BlockChain(), sealingLogAtDepth),
+		sealGuard:          sharedSealGuard,
 		pendingTasks:       make(map[common.Hash]*task),
 		txsCh:              make(chan core.NewTxsEvent, txChanSize),
 		chainHeadCh:        make(chan core.ChainHeadEvent, chainHeadChanSize),
 		chainSideCh:        make(chan core.ChainSideEvent, chainSideChanSize),
 		newWorkCh:          make(chan *newWorkReq),
 		getWorkCh:          make(chan *getWorkReq),
+		bundleCh:           make(chan *bundleReq),
+		baseFeeCh:          make(chan chan struct{}),
+		gasPoolCh:          make(chan chan *core.GasPool),
 		taskCh:             make(chan *task),
 		resultCh:           make(chan *types.Block, resultQueueSize),
 		exitCh:             make(chan struct{}),
@@ -270,6 +358,12 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		log.Warn("Sanitizing miner recommit interval", "provided", recommit, "updated", minRecommitInterval)
 		recommit = minRecommitInterval
 	}
+	if floor := worker.config.MinBaseFee; floor != nil && floor.Sign() < 0 {
+		log.Warn("Ignoring negative miner base fee floor", "provided", floor)
+	}
+	if window := worker.config.GasLimitUncleWindow; window < 0 {
+		log.Warn("Sanitizing miner gas limit uncle window", "provided", window, "updated", gasLimitUncleWindow)
+	}
 
 	worker.wg.Add(4)
 	go worker.mainLoop()
@@ -284,11 +378,82 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 	return worker
 }
 
+// getCoinbase returns the etherbase used to initialize the block coinbase field.
+func (w *worker) getCoinbase() common.Address {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.coinbase
+}
+
 // setEtherbase sets the etherbase used to initialize the block coinbase field.
-func (w *worker) setEtherbase(addr common.Address) {
+func (w *worker) setEtherbase(addr common.Address) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	if err := w.checkCoinbase(addr); err != nil {
+		return err
+	}
 	w.coinbase = addr
+	return nil
+}
+
+// prepareFailed surfaces a failure of the consensus engine to prepare a sealing
+// header, raising an alert and optionally stopping sealing once the configured
+// number of consecutive failures is reached.
+func (w *worker) prepareFailed(err error) {
+	// Alert from a goroutine so a slow subscriber cannot stall the main loop
+	go w.prepareErrFeed.Send(PrepareFailure{Err: err})
+
+	misses := atomic.AddInt32(&w.prepareMiss, 1)
+	if threshold := w.config.PrepareFailureThreshold; threshold > 0 && int(misses) == threshold {
+		log.Error("Consensus engine repeatedly failed to prepare sealing blocks", "failures", misses, "err", err)
+		if w.config.StopOnPrepareFailure && w.isRunning() {
+			log.Error("Stopping miner due to preparation failures")
+			w.stop()
+		}
+	}
+}
+
+// assemblyFailed records a failure to assemble a sealing block on top of the
+// given parent, raising an alert once the configured threshold is reached.
+func (w *worker) assemblyFailed(parent common.Hash, err error) {
+	if parent != w.assemblyParent {
+		w.assemblyParent, w.assemblyMiss = parent, 0
+	}
+	w.assemblyMiss++
+	if threshold := w.config.AssemblyFailureThreshold; threshold > 0 && w.assemblyMiss == threshold {
+		log.Error("Repeatedly failed to assemble sealing blocks, pausing until the head changes", "parent", parent, "failures", w.assemblyMiss, "err", err)
+		w.assemblyFailFeed.Send(AssemblyFailure{Parent: parent, Failures: w.assemblyMiss, Err: err})
+	}
+}
+
+// assemblyBlocked reports whether building on top of the given parent is paused
+// due to repeated assembly failures.
+func (w *worker) assemblyBlocked(parent common.Hash) bool {
+	threshold := w.config.AssemblyFailureThreshold
+	return threshold > 0 && parent == w.assemblyParent && w.assemblyMiss >= threshold
+}
+
+// validateCoinbase checks whether the given address would be accepted as the
+// coinbase of sealing blocks: it has to be set and pass the configured policies.
+func (w *worker) validateCoinbase(addr common.Address) error {
+	if addr == (common.Address{}) {
+		return errNoCoinbase
+	}
+	return w.checkCoinbase(addr)
+}
+
+// checkCoinbase verifies that the given address is in the configured set of
+// allowed coinbases. Any address is accepted if no set is configured.
+func (w *worker) checkCoinbase(addr common.Address) error {
+	if w.config.AllowedCoinbases == nil {
+		return nil
+	}
+	for _, allowed := range w.config.AllowedCoinbases {
+		if allowed == addr {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %x", errCoinbaseNotAllowed, addr)
 }
 
 func (w *worker) setGasCeil(ceil uint64) {
@@ -304,6 +469,45 @@ func (w *worker) setExtra(extra []byte) {
 	w.extra = extra
 }
 
+// getExtra returns a copy of the content used to initialize the block extra field.
+func (w *worker) getExtra() []byte {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return common.CopyBytes(w.extra)
+}
+
+// setTxFilter sets the custom policy deciding which transactions are eligible
+// for inclusion in the sealing block.
+func (w *worker) setTxFilter(filter TxFilter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.txFilter = filter
+}
+
+// setTxReadyFunc sets the custom policy deferring transactions which are not yet
+// ready for inclusion at the timestamp of the sealing block.
+func (w *worker) setTxReadyFunc(ready TxReadyFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.txReady = ready
+}
+
+// setTxDeadlineFunc sets the custom policy excluding transactions whose deadline
+// precedes the timestamp of the sealing block.
+func (w *worker) setTxDeadlineFunc(deadline TxDeadlineFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.txDeadline = deadline
+}
+
+// setSealResultHandler sets the callback taking over the handling of sealed
+// blocks. A nil handler restores the default processing.
+func (w *worker) setSealResultHandler(handler func(block *types.Block)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onSealResult = handler
+}
+
 // setRecommitInterval updates the interval for miner sealing work recommitting.
 func (w *worker) setRecommitInterval(interval time.Duration) {
 	select {
@@ -312,6 +516,50 @@ func (w *worker) setRecommitInterval(interval time.Duration) {
 	}
 }
 
+// applyConfig validates all changes of the patch and applies them in a single
+// critical section, leaving the worker unchanged if any of them is invalid.
+func (w *worker) applyConfig(patch ConfigPatch) error {
+	w.mu.Lock()
+	if patch.Coinbase != nil {
+		if err := w.checkCoinbase(*patch.Coinbase); err != nil {
+			w.mu.Unlock()
+			return err
+		}
+	}
+	if uint64(len(patch.Extra)) > params.MaximumExtraDataSize {
+		w.mu.Unlock()
+		return fmt.Errorf("extra exceeds max length. %d > %v", len(patch.Extra), params.MaximumExtraDataSize)
+	}
+	if patch.GasCeil != nil && *patch.GasCeil < params.MinGasLimit {
+		w.mu.Unlock()
+		return fmt.Errorf("gas ceil below minimum. %d < %v", *patch.GasCeil, params.MinGasLimit)
+	}
+	if patch.Recommit != nil && *patch.Recommit < minRecommitInterval {
+		w.mu.Unlock()
+		return fmt.Errorf("recommit interval below minimum. %v < %v", *patch.Recommit, minRecommitInterval)
+	}
+	if patch.Coinbase != nil {
+		w.coinbase = *patch.Coinbase
+	}
+	if patch.Extra != nil {
+		w.extra = patch.Extra
+	}
+	if patch.GasCeil != nil {
+		w.config.GasCeil = *patch.GasCeil
+	}
+	if patch.Recommit != nil {
+		w.config.Recommit = *patch.Recommit
+	}
+	w.mu.Unlock()
+
+	// The interval is handed to the work loop outside of the lock, as the loop
+	// may be waiting for the sealing block assembly which acquires it.
+	if patch.Recommit != nil {
+		w.setRecommitInterval(*patch.Recommit)
+	}
+	return nil
+}
+
 // disablePreseal disables pre-sealing feature
 func (w *worker) disablePreseal() {
 	atomic.StoreUint32(&w.noempty, 1)
@@ -333,6 +581,35 @@ func (w *worker) pending() (*types.Block, *state.StateDB) {
 	return w.snapshotBlock, w.snapshotState.Copy()
 }
 
+// pendingComputedRoot previews the state root the pending block commits to once
+// assembled. The post-transaction modifications of the consensus engine, like
+// the block rewards, are applied to a copy of the pending state, leaving the
+// pending block untouched.
+func (w *worker) pendingComputedRoot() (common.Hash, error) {
+	w.snapshotMu.RLock()
+	defer w.snapshotMu.RUnlock()
+
+	if w.snapshotBlock == nil || w.snapshotState == nil {
+		return common.Hash{}, errNoPendingBlock
+	}
+	header := types.CopyHeader(w.snapshotBlock.Header())
+	w.engine.Finalize(w.chain, header, w.snapshotState.Copy(), w.snapshotBlock.Transactions(), w.snapshotBlock.Uncles())
+	return header.Root[types.QuaiNetworkContext], nil
+}
+
+// currentSealingHeader returns a copy of the header of the current sealing block
+// as filled so far, before the block is assembled. False is returned if there is
+// no sealing block yet.
+func (w *worker) currentSealingHeader() (*types.Header, bool) {
+	w.snapshotMu.RLock()
+	defer w.snapshotMu.RUnlock()
+
+	if w.snapshotHeader == nil {
+		return nil, false
+	}
+	return types.CopyHeader(w.snapshotHeader), true
+}
+
 // pendingBlock returns pending block.
 func (w *worker) pendingBlock() *types.Block {
 	// return a snapshot to avoid contention on currentMu mutex
@@ -341,6 +618,21 @@ func (w *worker) pendingBlock() *types.Block {
 	return w.snapshotBlock
 }
 
+// pendingBlockTransactions returns a copy of the transactions of the pending
+// block, or an empty list if there is none.
+func (w *worker) pendingBlockTransactions() types.Transactions {
+	w.snapshotMu.RLock()
+	defer w.snapshotMu.RUnlock()
+
+	if w.snapshotBlock == nil {
+		return types.Transactions{}
+	}
+	txs := w.snapshotBlock.Transactions()
+	cpy := make(types.Transactions, len(txs))
+	copy(cpy, txs)
+	return cpy
+}
+
 // pendingBlockAndReceipts returns pending block and corresponding receipts.
 func (w *worker) pendingBlockAndReceipts() (*types.Block, types.Receipts) {
 	// return a snapshot to avoid contention on currentMu mutex
@@ -349,15 +641,243 @@ func (w *worker) pendingBlockAndReceipts() (*types.Block, types.Receipts) {
 	return w.snapshotBlock, w.snapshotReceipts
 }
 
+// pendingUncleHashes returns the hashes of the uncles included in the pending block.
+func (w *worker) pendingUncleHashes() []common.Hash {
+	w.snapshotMu.RLock()
+	defer w.snapshotMu.RUnlock()
+
+	hashes := make([]common.Hash, 0)
+	if w.snapshotBlock == nil {
+		return hashes
+	}
+	for _, uncle := range w.snapshotBlock.Uncles() {
+		hashes = append(hashes, uncle.Hash())
+	}
+	return hashes
+}
+
+// pendingUncleCount returns the number of uncles included in the pending block.
+func (w *worker) pendingUncleCount() int {
+	w.snapshotMu.RLock()
+	defer w.snapshotMu.RUnlock()
+
+	if w.snapshotBlock == nil {
+		return 0
+	}
+	return len(w.snapshotBlock.Uncles())
+}
+
+// pendingUncleRewards returns the rewards credited to the coinbases of the uncles
+// included in the pending block, as computed by the consensus engine.
+func (w *worker) pendingUncleRewards() map[common.Address]*big.Int {
+	w.snapshotMu.RLock()
+	defer w.snapshotMu.RUnlock()
+
+	rewards := make(map[common.Address]*big.Int)
+	rewarder, ok := w.engine.(consensus.Rewarder)
+	if !ok || w.snapshotBlock == nil {
+		return rewards
+	}
+	header := w.snapshotBlock.Header()
+	rp := rewarder.RewardParameters(w.chain, header.Number[types.QuaiNetworkContext].Uint64())
+	for _, uncle := range w.snapshotBlock.Uncles() {
+		coinbase := uncle.Coinbase[types.QuaiNetworkContext]
+		if rewards[coinbase] == nil {
+			rewards[coinbase] = new(big.Int)
+		}
+		rewards[coinbase].Add(rewards[coinbase], rp.UncleReward(header, uncle))
+	}
+	return rewards
+}
+
+// effectiveTip returns the miner tip the given transaction would pay if it was
+// included in the pending block.
+func (w *worker) effectiveTip(tx *types.Transaction) (*big.Int, error) {
+	w.snapshotMu.RLock()
+	defer w.snapshotMu.RUnlock()
+
+	if w.snapshotBlock == nil {
+		return nil, errNoPendingBlock
+	}
+	return tx.EffectiveGasTip(w.snapshotBlock.BaseFee())
+}
+
+// pendingNonce returns the next nonce of the given account, taking into account
+// the transactions already packed into the pending block. If there is no pending
+// block yet, the nonce is retrieved from the current chain state.
+func (w *worker) pendingNonce(addr common.Address) uint64 {
+	// Reading the state may populate its caches, hold the exclusive lock
+	w.snapshotMu.Lock()
+	if w.snapshotState != nil {
+		nonce := w.snapshotState.GetNonce(addr)
+		w.snapshotMu.Unlock()
+		return nonce
+	}
+	w.snapshotMu.Unlock()
+
+	statedb, err := w.chain.State()
+	if err != nil {
+		log.Warn("Failed to retrieve chain state", "err", err)
+		return 0
+	}
+	return statedb.GetNonce(addr)
+}
+
+// pendingTxFeeStats returns the minimum, median and maximum effective miner tip
+// paid by the transactions in the pending block. The flag reports whether there
+// was any pending transaction to compute the statistics over.
+func (w *worker) pendingTxFeeStats() (min, median, max *big.Int, ok bool) {
+	w.snapshotMu.RLock()
+	block := w.snapshotBlock
+	w.snapshotMu.RUnlock()
+
+	if block == nil || len(block.Transactions()) == 0 {
+		return nil, nil, nil, false
+	}
+	var baseFee *big.Int
+	if fees := block.Header().BaseFee; len(fees) > types.QuaiNetworkContext {
+		baseFee = fees[types.QuaiNetworkContext]
+	}
+	tips := make([]*big.Int, 0, len(block.Transactions()))
+	for _, tx := range block.Transactions() {
+		tip, _ := tx.EffectiveGasTip(baseFee)
+		tips = append(tips, tip)
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i].Cmp(tips[j]) < 0 })
+
+	mid := len(tips) / 2
+	median = new(big.Int).Set(tips[mid])
+	if len(tips)%2 == 0 {
+		median.Add(median, tips[mid-1])
+		median.Rsh(median, 1)
+	}
+	return new(big.Int).Set(tips[0]), median, new(big.Int).Set(tips[len(tips)-1]), true
+}
+
+// pendingFeeBreakdown returns the fees paid to the miner by every transaction of
+// the pending block.
+func (w *worker) pendingFeeBreakdown() []TxFee {
+	w.snapshotMu.RLock()
+	block, receipts := w.snapshotBlock, w.snapshotReceipts
+	w.snapshotMu.RUnlock()
+
+	if block == nil {
+		return nil
+	}
+	fees := make([]TxFee, 0, len(block.Transactions()))
+	for i, tx := range block.Transactions() {
+		tip, _ := tx.EffectiveGasTip(block.BaseFee())
+		fees = append(fees, TxFee{
+			Hash:         tx.Hash(),
+			GasUsed:      receipts[i].GasUsed,
+			EffectiveTip: tip,
+			TotalFee:     new(big.Int).Mul(tip, new(big.Int).SetUint64(receipts[i].GasUsed)),
+		})
+	}
+	return fees
+}
+
+// highestFeeTx returns the transaction of the pending block paying the largest
+// total tip to the miner along with that tip, or false if there is none.
+func (w *worker) highestFeeTx() (*types.Transaction, *big.Int, bool) {
+	w.snapshotMu.RLock()
+	block, receipts := w.snapshotBlock, w.snapshotReceipts
+	w.snapshotMu.RUnlock()
+
+	if block == nil {
+		return nil, nil, false
+	}
+	var (
+		best    *types.Transaction
+		bestFee *big.Int
+	)
+	for i, tx := range block.Transactions() {
+		tip, _ := tx.EffectiveGasTip(block.BaseFee())
+		fee := new(big.Int).Mul(tip, new(big.Int).SetUint64(receipts[i].GasUsed))
+		if best == nil || fee.Cmp(bestFee) > 0 {
+			best, bestFee = tx, fee
+		}
+	}
+	return best, bestFee, best != nil
+}
+
+// lastDroppedTxs returns the hashes of the transactions which failed with an
+// unexpected error during the last sealing cycle.
+func (w *worker) lastDroppedTxs() []common.Hash {
+	w.snapshotMu.RLock()
+	defer w.snapshotMu.RUnlock()
+
+	dropped := make([]common.Hash, len(w.snapshotDropped))
+	copy(dropped, w.snapshotDropped)
+	return dropped
+}
+
+// lastFillResult reports why filling the last pending block with transactions
+// ended.
+func (w *worker) lastFillResult() BlockFillResult {
+	w.snapshotMu.RLock()
+	defer w.snapshotMu.RUnlock()
+	return w.snapshotFill
+}
+
 // start sets the running status as 1 and triggers new work submitting.
 func (w *worker) start() {
+	atomic.StoreInt32(&w.idleCycles, 0)
 	atomic.StoreInt32(&w.running, 1)
 	w.startCh <- struct{}{}
 }
 
+// resume sets the running status as 1 and triggers new work submitting, like
+// start, but without blocking if a submission is already scheduled. It is safe
+// to call from the main loop, which the new work loop may be waiting on.
+func (w *worker) resume() {
+	atomic.StoreInt32(&w.idleCycles, 0)
+	atomic.StoreInt32(&w.running, 1)
+	w.seedPending()
+}
+
+// seedPending triggers building the pending block on top of the current head,
+// without enabling sealing. It is a no-op if a build is already scheduled.
+func (w *worker) seedPending() {
+	select {
+	case w.startCh <- struct{}{}:
+	default:
+	}
+}
+
 // stop sets the running status as 0.
 func (w *worker) stop() {
+	atomic.StoreInt32(&w.idleStopped, 0)
 	atomic.StoreInt32(&w.running, 0)
+	w.sealGuard.release(w)
+}
+
+// stopIfIdle stops sealing if the configured number of consecutive empty cycles
+// has been reached. Sealing is resumed once new transactions arrive.
+func (w *worker) stopIfIdle() {
+	threshold := w.config.IdleStopThreshold
+	if threshold <= 0 || !w.isRunning() || atomic.LoadInt32(&w.idleCycles) < int32(threshold) {
+		return
+	}
+	log.Info("Stopping idle miner", "cycles", atomic.LoadInt32(&w.idleCycles))
+	w.stop()
+	atomic.StoreInt32(&w.idleStopped, 1)
+}
+
+// setSigner overrides the signer used by the sealing environments, only use it
+// for testing.
+func (w *worker) setSigner(signer types.Signer) {
+	w.signerOverride = signer
+}
+
+// instantSeal returns whether a new sealing block is committed on every
+// transaction arrival instead of periodically, either because it's configured
+// or because the engine is a zero period clique.
+func (w *worker) instantSeal() bool {
+	if w.config.InstantSeal {
+		return true
+	}
+	return w.chainConfig.Clique != nil && w.chainConfig.Clique.Period == 0
 }
 
 // isRunning returns an indicator whether worker is running or not.
@@ -365,12 +885,40 @@ func (w *worker) isRunning() bool {
 	return atomic.LoadInt32(&w.running) == 1
 }
 
+// status returns a consistent view of the worker's operational state.
+func (w *worker) status() WorkerStatus {
+	w.mu.RLock()
+	coinbase := w.coinbase
+	w.mu.RUnlock()
+
+	return WorkerStatus{
+		Running:  w.isRunning(),
+		Preseal:  atomic.LoadUint32(&w.noempty) == 0,
+		Coinbase: coinbase,
+	}
+}
+
 // close terminates all background threads maintained by the worker.
 // Note the worker does not support being closed multiple times.
 func (w *worker) close() {
 	atomic.StoreInt32(&w.running, 0)
 	close(w.exitCh)
 	w.wg.Wait()
+	w.sealGuard.release(w)
+}
+
+// missingParentDelay calculates the delay before retrying a sealing cycle which
+// failed the given number of consecutive times due to a missing parent. The delay
+// doubles on every failure, starting from the recommit interval, up to the limit.
+func missingParentDelay(recommit, limit time.Duration, misses int32) time.Duration {
+	delay := recommit
+	for i := int32(0); i < misses && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
 }
 
 // recalcRecommit recalculates the resubmitting interval upon feedback.
@@ -395,6 +943,98 @@ func recalcRecommit(minRecommit, prev time.Duration, target float64, inc bool) t
 	return time.Duration(int64(next))
 }
 
+// taskStaleThreshold returns the depth at which pending sealing tasks are dropped.
+func (w *worker) taskStaleThreshold() uint64 {
+	if w.config.TaskStaleThreshold > 0 {
+		return w.config.TaskStaleThreshold
+	}
+	return staleThreshold
+}
+
+// gasLimitUncleWindow returns the number of blocks whose uncles are counted when
+// adjusting the gas limit.
+func (w *worker) gasLimitUncleWindow() int {
+	if w.config.GasLimitUncleWindow > 0 {
+		return w.config.GasLimitUncleWindow
+	}
+	return gasLimitUncleWindow
+}
+
+// uncleStaleThreshold returns the depth at which possible uncle blocks are dropped.
+func (w *worker) uncleStaleThreshold() uint64 {
+	if w.config.UncleStaleThreshold > 0 {
+		return w.config.UncleStaleThreshold
+	}
+	return staleThreshold
+}
+
+// clearPending cleans the stale pending tasks.
+func (w *worker) clearPending(number uint64) {
+	threshold := w.taskStaleThreshold()
+
+	w.pendingMu.Lock()
+	defer w.pendingMu.Unlock()
+	for h, t := range w.pendingTasks {
+		if t.block.NumberU64()+threshold <= number {
+			delete(w.pendingTasks, h)
+		}
+	}
+}
+
+// limitPending evicts the oldest pending tasks until the configured maximum is
+// honoured. It assumes the pending lock is held.
+func (w *worker) limitPending() {
+	limit := w.config.MaxPendingTasks
+	if limit <= 0 {
+		return
+	}
+	for len(w.pendingTasks) > limit {
+		var (
+			oldest common.Hash
+			first  *task
+		)
+		for h, t := range w.pendingTasks {
+			if first == nil || t.createdAt.Before(first.createdAt) {
+				oldest, first = h, t
+			}
+		}
+		delete(w.pendingTasks, oldest)
+	}
+}
+
+// clearStaleUncles drops the possible uncle blocks which are too deep to be
+// included anymore.
+func (w *worker) clearStaleUncles(number uint64) {
+	threshold := w.uncleStaleThreshold()
+	for hash, uncle := range w.localUncles {
+		if uncle.NumberU64()+threshold <= number {
+			delete(w.localUncles, hash)
+		}
+	}
+	for hash, uncle := range w.remoteUncles {
+		if uncle.NumberU64()+threshold <= number {
+			delete(w.remoteUncles, hash)
+		}
+	}
+}
+
+// capUncles drops the oldest possible uncle blocks from both the local and the
+// remote set if they hold more than the configured number of candidates.
+func (w *worker) capUncles() {
+	limit := w.config.MaxUncleCandidates
+	if limit <= 0 {
+		return
+	}
+	for _, uncles := range []map[common.Hash]*types.Block{w.localUncles, w.remoteUncles} {
+		if len(uncles) <= limit {
+			continue
+		}
+		for _, uncle := range orderUncles(uncles)[limit:] {
+			delete(uncles, uncle.Hash())
+		}
+	}
+}
+
 // newWorkLoop is a standalone goroutine to submit new sealing work upon received events.
 func (w *worker) newWorkLoop(recommit time.Duration) {
 	defer w.wg.Done()
@@ -402,14 +1042,40 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 		interrupt   *int32
 		minRecommit = recommit // minimal resubmit interval specified by user.
 		timestamp   int64      // timestamp for each round of sealing.
+
+		lastCommit      time.Time // time of the last submitted sealing request
+		throttled       bool      // whether a sealing request is held back by the commit throttle
+		throttledEmpty  bool      // whether the held back request may skip the empty block
+		throttledSignal int32     // interrupt signal of the held back request
 	)
 
 	timer := time.NewTimer(0)
 	defer timer.Stop()
 	<-timer.C // discard the initial tick
 
+	throttle := time.NewTimer(0)
+	defer throttle.Stop()
+	<-throttle.C // discard the initial tick
+
 	// commit aborts in-flight transaction execution with given signal and resubmits a new one.
 	commit := func(noempty bool, s int32) {
+		// Coalesce requests arriving faster than the minimum commit interval into
+		// a single one, submitted once the interval elapses.
+		if wait := w.config.MinCommitInterval - time.Since(lastCommit); w.config.MinCommitInterval > 0 && wait > 0 {
+			if !throttled {
+				throttled, throttledEmpty, throttledSignal = true, noempty, s
+				throttle.Reset(wait)
+			} else {
+				throttledEmpty = throttledEmpty && noempty
+				if s == commitInterruptNewHead {
+					throttledSignal = s
+				}
+			}
+			return
+		}
+		throttled = false
+		lastCommit = time.Now()
+
 		if interrupt != nil {
 			atomic.StoreInt32(interrupt, s)
 		}
@@ -419,36 +1085,42 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 		case <-w.exitCh:
 			return
 		}
-		timer.Reset(recommit)
-		atomic.StoreInt32(&w.newTxs, 0)
-	}
-	// clearPending cleans the stale pending tasks.
-	clearPending := func(number uint64) {
-		w.pendingMu.Lock()
-		for h, t := range w.pendingTasks {
-			if t.block.NumberU64()+staleThreshold <= number {
-				delete(w.pendingTasks, h)
-			}
+		if misses := atomic.LoadInt32(&w.parentMiss); misses > 0 && w.config.MissingParentBackoff > 0 {
+			timer.Reset(missingParentDelay(recommit, w.config.MissingParentBackoff, misses))
+		} else {
+			timer.Reset(recommit)
 		}
-		w.pendingMu.Unlock()
+		atomic.StoreInt32(&w.newTxs, 0)
 	}
-
 	for {
 		select {
 		case <-w.startCh:
-			clearPending(w.chain.CurrentBlock().NumberU64())
+			w.clearPending(w.chain.CurrentBlock().NumberU64())
 			timestamp = time.Now().Unix()
 			commit(false, commitInterruptNewHead)
 
 		case head := <-w.chainHeadCh:
-			clearPending(head.Block.NumberU64())
+			w.clearPending(head.Block.NumberU64())
+			w.stopIfIdle()
 			timestamp = time.Now().Unix()
 			commit(false, commitInterruptNewHead)
 
+		case <-throttle.C:
+			if throttled {
+				commit(throttledEmpty, throttledSignal)
+			}
+
 		case <-timer.C:
+			// Retry the sealing work if the last attempt failed due to a missing
+			// parent, backing off further on every failure.
+			if atomic.LoadInt32(&w.parentMiss) > 0 && w.config.MissingParentBackoff > 0 {
+				timestamp = time.Now().Unix()
+				commit(false, commitInterruptNewHead)
+				continue
+			}
 			// If sealing is running resubmit a new work cycle periodically to pull in
 			// higher priced transactions. Disable this overhead for pending blocks.
-			if w.isRunning() && (w.chainConfig.Clique == nil || w.chainConfig.Clique.Period > 0) {
+			if w.isRunning() && !w.instantSeal() {
 				// Short circuit if no new transaction arrives.
 				if atomic.LoadInt32(&w.newTxs) == 0 {
 					timer.Reset(recommit)
@@ -524,6 +1196,29 @@ func (w *worker) mainLoop() {
 				req.result <- block
 			}
 
+		case req := <-w.bundleCh:
+			err := w.commitBundle(w.current, req.txs)
+			if err == nil {
+				w.updateSnapshot(w.current)
+			}
+			req.result <- err
+
+		case done := <-w.baseFeeCh:
+			// Rebuild the sealing block from scratch, as the transactions it
+			// already contains were selected and executed against the old base fee.
+			if w.current != nil {
+				w.commitWork(nil, false, time.Now().Unix())
+			}
+			close(done)
+
+		case result := <-w.gasPoolCh:
+			if w.current == nil || w.current.gasPool == nil {
+				result <- nil
+			} else {
+				gp := *w.current.gasPool
+				result <- &gp
+			}
+
 		case ev := <-w.chainSideCh:
 			// Short circuit for duplicate side blocks
 			if _, exist := w.localUncles[ev.Block.Hash()]; exist {
@@ -538,10 +1233,15 @@ func (w *worker) mainLoop() {
 			} else {
 				w.remoteUncles[ev.Block.Hash()] = ev.Block
 			}
+			w.capUncles()
 			// If our sealing block contains less than 2 uncle blocks,
 			// add the new uncle block if valid and regenerate a new
 			// sealing block for higher profit.
 			if w.isRunning() && w.current != nil && len(w.current.uncles) < 2 {
+				if !w.worthRebuilding(w.current, ev.Block.Header()) {
+					log.Debug("Deferring uncle inclusion to next cycle", "hash", ev.Block.Hash())
+					continue
+				}
 				start := time.Now()
 				if err := w.commitUncle(w.current, ev.Block.Header()); err == nil {
 					w.commit(w.current.copy(), nil, true, start)
@@ -549,17 +1249,8 @@ func (w *worker) mainLoop() {
 			}
 
 		case <-cleanTicker.C:
-			chainHead := w.chain.CurrentBlock()
-			for hash, uncle := range w.localUncles {
-				if uncle.NumberU64()+staleThreshold <= chainHead.NumberU64() {
-					delete(w.localUncles, hash)
-				}
-			}
-			for hash, uncle := range w.remoteUncles {
-				if uncle.NumberU64()+staleThreshold <= chainHead.NumberU64() {
-					delete(w.remoteUncles, hash)
-				}
-			}
+			w.clearStaleUncles(w.chain.CurrentBlock().NumberU64())
+			w.capUncles()
 
 		case ev := <-w.txsCh:
 			// Apply transactions to the pending state if we're not sealing
@@ -568,6 +1259,14 @@ func (w *worker) mainLoop() {
 			// already included in the current sealing block. These transactions will
 			// be automatically eliminated.
 			if !w.isRunning() && w.current != nil {
+				// Swap included transactions for higher paying replacements if allowed
+				if w.config.AllowPendingReplacement {
+					if env := w.replaceTransactions(w.current, ev.Txs); env != nil {
+						w.current.discard()
+						w.current = env
+						w.updatePending(env, false)
+					}
+				}
 				// If block is already full, abort
 				if gp := w.current.gasPool; gp != nil && gp.Gas() < params.TxGas {
 					continue
@@ -577,25 +1276,31 @@ func (w *worker) mainLoop() {
 					acc, _ := types.Sender(w.current.signer, tx)
 					txs[acc] = append(txs[acc], tx)
 				}
-				txset := types.NewTransactionsByPriceAndNonce(w.current.signer, txs, w.current.header.BaseFee[types.QuaiNetworkContext])
+				txset := w.orderTransactions(w.current, txs)
 				tcount := w.current.tcount
 				w.commitTransactions(w.current, txset, nil)
 
 				// Only update the snapshot if any new transactions were added
 				// to the pending block
 				if tcount != w.current.tcount {
-					w.updateSnapshot(w.current)
+					w.updatePending(w.current, false)
 				}
 			} else {
-				// Special case, if the consensus engine is 0 period clique(dev mode),
-				// submit sealing work here since all empty submission will be rejected
-				// by clique. Of course the advance sealing(empty submission) is disabled.
-				if w.chainConfig.Clique != nil && w.chainConfig.Clique.Period == 0 {
+				// Special case, if instant sealing is enabled (e.g. 0 period clique
+				// dev mode), submit sealing work here since all empty submission will
+				// be rejected. Of course the advance sealing(empty submission) is disabled.
+				if w.instantSeal() {
 					w.commitWork(nil, true, time.Now().Unix())
 				}
 			}
 			atomic.AddInt32(&w.newTxs, int32(len(ev.Txs)))
 
+			// Resume sealing if it was stopped due to idleness
+			if atomic.CompareAndSwapInt32(&w.idleStopped, 1, 0) {
+				log.Info("Resuming idle miner", "txs", len(ev.Txs))
+				w.resume()
+			}
+
 		// System stopped
 		case <-w.exitCh:
 			return
@@ -631,11 +1336,18 @@ func (w *worker) taskLoop() {
 			if w.newTaskHook != nil {
 				w.newTaskHook(task)
 			}
+			// Reject sealing work which has been waiting for too long, it's superseded.
+			if age := time.Since(task.createdAt); w.config.MaxTaskAge > 0 && age > w.config.MaxTaskAge {
+				log.Debug("Dropping stale sealing task", "number", task.block.Number(), "age", common.PrettyDuration(age))
+				continue
+			}
 			// Reject duplicate sealing work due to resubmitting.
 			sealHash := w.engine.SealHash(task.block.Header())
 			if sealHash == prev {
+				if !w.config.AllowDuplicateSealTasks {
+					continue
+				}
 				log.Info("sealHash == prev, continuing with sending task to pending channel", "seal", sealHash, "prev", prev)
-				// continue
 			}
 			// Interrupt previous sealing operation
 			interrupt()
@@ -646,6 +1358,7 @@ func (w *worker) taskLoop() {
 			// }
 			w.pendingMu.Lock()
 			w.pendingTasks[sealHash] = task
+			w.limitPending()
 			w.pendingMu.Unlock()
 
 			w.snapshotMu.Lock()
@@ -669,6 +1382,14 @@ func (w *worker) resultLoop() {
 			if block == nil {
 				continue
 			}
+			// Hand the result over if a custom handler decides what to do with it
+			w.mu.RLock()
+			handler := w.onSealResult
+			w.mu.RUnlock()
+			if handler != nil {
+				handler(block)
+				continue
+			}
 			// Short circuit when receiving duplicate result caused by resubmitting.
 			if w.chain.HasBlock(block.Hash(), block.NumberU64()) {
 				continue
@@ -716,6 +1437,7 @@ func (w *worker) resultLoop() {
 
 			// Broadcast the block and announce chain insertion event
 			w.mux.Post(core.NewMinedBlockEvent{Block: block})
+			w.minedBlockFeed.Send(block)
 
 			// Insert the block into the set of pending ones to resultLoop for confirmations
 			w.unconfirmed.Insert(block.NumberU64(), block.Hash())
@@ -738,17 +1460,20 @@ func (w *worker) makeEnv(parent *types.Block, header *types.Header, coinbase com
 		//
 		// The maximum acceptable reorg depth can be limited by the finalised block
 		// somehow. TODO(rjl493456442) fix the hard-coded number here later.
-		state, err = w.eth.StateAtBlock(parent, 1024, nil, false, false)
-		log.Warn("Recovered mining state", "root", parent.Root(), "err", err)
+		state, err = w.recoverState(parent)
 	}
 	if err != nil {
 		return nil, err
 	}
 	state.StartPrefetcher("miner")
 
+	signer := types.MakeSigner(w.chainConfig, header.Number[types.QuaiNetworkContext])
+	if w.signerOverride != nil {
+		signer = w.signerOverride
+	}
 	// Note the passed coinbase may be different with header.Coinbase.
 	env := &environment{
-		signer:          types.MakeSigner(w.chainConfig, header.Number[types.QuaiNetworkContext]),
+		signer:          signer,
 		state:           state,
 		coinbase:        coinbase,
 		ancestors:       mapset.NewSet(),
@@ -765,13 +1490,55 @@ func (w *worker) makeEnv(parent *types.Block, header *types.Header, coinbase com
 		env.family.Add(ancestor.Hash())
 		env.ancestors.Add(ancestor.Hash())
 	}
-	// Keep track of transactions which return errors so they can be removed
 	env.tcount = 0
 	return env, nil
 }
 
+// recoverState regenerates the state of the given block through the backend.
+// Transient failures (e.g. state cache misses under load) are retried up to
+// the configured number of times, backing off exponentially in between.
+func (w *worker) recoverState(block *types.Block) (*state.StateDB, error) {
+	delay := w.config.StateRetryDelay
+	for attempt := 0; ; attempt++ {
+		statedb, err := w.eth.StateAtBlock(block, 1024, nil, false, false)
+		if err == nil {
+			log.Debug("Recovered mining state", "root", block.Root(), "attempts", attempt+1)
+			return statedb, nil
+		}
+		if attempt >= w.config.StateRetries {
+			log.Warn("Failed to recover mining state", "root", block.Root(), "attempts", attempt+1, "err", err)
+			return nil, err
+		}
+		select {
+		case <-time.After(delay):
+		case <-w.exitCh:
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
 // commitUncle adds the given block to uncle block set, returns error if failed to add.
 func (w *worker) commitUncle(env *environment, uncle *types.Header) error {
+	hash := uncle.Hash()
+	err := env.checkUncle(uncle)
+	if err == nil {
+		// Hold back uncles which may still become canonical elsewhere
+		age := new(big.Int).Sub(env.header.Number[types.QuaiNetworkContext], uncle.Number[types.QuaiNetworkContext])
+		if min := w.config.MinUncleAge; min > 0 && age.Cmp(new(big.Int).SetUint64(min)) < 0 {
+			err = errors.New("uncle too recent")
+		}
+	}
+	if err != nil {
+		go w.uncleRejectedFeed.Send(UncleRejection{Hash: hash, Reason: err.Error()})
+		return err
+	}
+	env.uncles[hash] = uncle
+	return nil
+}
+
+// checkUncle verifies whether the uncle may be included in the sealing block.
+func (env *environment) checkUncle(uncle *types.Header) error {
 	hash := uncle.Hash()
 	if _, exist := env.uncles[hash]; exist {
 		return errors.New("uncle not unique")
@@ -785,10 +1552,100 @@ func (w *worker) commitUncle(env *environment, uncle *types.Header) error {
 	if env.family.Contains(hash) {
 		return errors.New("uncle already included")
 	}
-	env.uncles[hash] = uncle
 	return nil
 }
 
+// orphanedLocalBlocks returns the hashes of the locally mined side blocks within
+// the given number of blocks below the chain head which were neither made
+// canonical nor included as uncles in the canonical chain.
+func (w *worker) orphanedLocalBlocks(window uint64) []common.Hash {
+	if w.isLocalBlock == nil {
+		return nil
+	}
+	number := w.chain.CurrentBlock().NumberU64()
+	first := uint64(1)
+	if number > window {
+		first = number - window + 1
+	}
+	included := make(map[common.Hash]struct{})
+	for n := first; n <= number; n++ {
+		if block := w.chain.GetBlockByNumber(n); block != nil {
+			for _, uncle := range block.Uncles() {
+				included[uncle.Hash()] = struct{}{}
+			}
+		}
+	}
+	var orphans []common.Hash
+	for n := first; n <= number; n++ {
+		for _, block := range w.chain.GetSideBlocksByNumber(n) {
+			if _, ok := included[block.Hash()]; ok || !w.isLocalBlock(block.Header()) {
+				continue
+			}
+			orphans = append(orphans, block.Hash())
+		}
+	}
+	return orphans
+}
+
+// sealingRequirements describes the solution an external sealer has to submit
+// for the configured consensus engine.
+func (w *worker) sealingRequirements() SealRequirements {
+	reqs := SealRequirements{Noverify: w.config.Noverify}
+	if engine, ok := w.engine.(consensus.Identifier); ok {
+		reqs.AlgorithmName, _ = engine.Identity()
+		reqs.HeaderFields = engine.SealFields()
+	} else {
+		reqs.AlgorithmName = fmt.Sprintf("%T", w.engine)
+	}
+	return reqs
+}
+
+// scanUncles collects the side blocks stored in the database within the given
+// depth below and including the given height as possible uncle blocks.
+func (w *worker) scanUncles(number uint64, depth int) map[common.Hash]*types.Block {
+	uncles := make(map[common.Hash]*types.Block)
+	for i := 0; i < depth && number > 0; i, number = i+1, number-1 {
+		for _, block := range w.chain.GetSideBlocksByNumber(number) {
+			uncles[block.Hash()] = block
+		}
+	}
+	return uncles
+}
+
+// worthRebuilding reports whether the given uncle should interrupt the sealing
+// of the block assembled in the given environment. If a rebuild margin is set,
+// the uncle reward needs to exceed the fees accumulated so far by that margin.
+func (w *worker) worthRebuilding(env *environment, uncle *types.Header) bool {
+	margin := w.config.UncleRebuildMargin
+	if margin == nil {
+		return true
+	}
+	rewarder, ok := w.engine.(consensus.Rewarder)
+	if !ok {
+		return true
+	}
+	reward := rewarder.RewardParameters(w.chain, env.header.Number[types.QuaiNetworkContext].Uint64()).UncleReward(env.header, uncle)
+	fees := accumulatedFees(env.txs, env.receipts, env.header.BaseFee[types.QuaiNetworkContext])
+	return reward.Cmp(fees.Add(fees, margin)) > 0
+}
+
+// orderUncles returns the given uncle candidates in the order they should be
+// considered for inclusion: the ones closest to the chain head first, as those
+// yield the highest uncle reward, with ties broken by hash.
+func orderUncles(blocks map[common.Hash]*types.Block) []*types.Block {
+	uncles := make([]*types.Block, 0, len(blocks))
+	for _, uncle := range blocks {
+		uncles = append(uncles, uncle)
+	}
+	sort.Slice(uncles, func(i, j int) bool {
+		if ni, nj := uncles[i].NumberU64(), uncles[j].NumberU64(); ni != nj {
+			return ni > nj
+		}
+		return bytes.Compare(uncles[i].Hash().Bytes(), uncles[j].Hash().Bytes()) < 0
+	})
+	return uncles
+}
+
 // updateSnapshot updates pending snapshot block, receipts and state.
 func (w *worker) updateSnapshot(env *environment) {
 	w.snapshotMu.Lock()
@@ -803,6 +1660,10 @@ func (w *worker) updateSnapshot(env *environment) {
 	)
 	w.snapshotReceipts = copyReceipts(env.receipts)
 	w.snapshotState = env.state.Copy()
+	w.snapshotDropped = make([]common.Hash, len(env.droppedTxs))
+	copy(w.snapshotDropped, env.droppedTxs)
+	w.snapshotFill = env.fillResult
+	w.snapshotHeader = types.CopyHeader(env.header)
 }
 
 func (w *worker) commitTransaction(env *environment, tx *types.Transaction) ([]*types.Log, error) {
@@ -839,13 +1700,121 @@ func (w *worker) commitExternalTransaction(env *environment, tx *types.Transacti
 	return nil, errors.New("error finding external transaction")
 }
 
-func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByPriceAndNonce, interrupt *int32) bool {
+// commitBundle applies the given transactions in order on top of the environment.
+// Either all of them are included or, if any fails or reverts, none of them and
+// the environment is left untouched.
+func (w *worker) commitBundle(env *environment, txs types.Transactions) error {
+	if env == nil {
+		return errors.New("no sealing block available")
+	}
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit[types.QuaiNetworkContext])
+	}
+	// Every transaction finalises the state, dropping the snapshots taken before
+	// it, so no single snapshot can roll back a failing bundle. Dry run it on a
+	// throwaway copy of the environment first, and only apply it if all passes.
+	sim := env.copy()
+	defer sim.discard()
+	if err := w.applyBundle(sim, txs); err != nil {
+		return err
+	}
+	return w.applyBundle(env, txs)
+}
+
+// applyBundle applies the given transactions in order on top of the environment,
+// each reverted on its own if failing, stopping at the first one which fails or
+// whose execution reverts.
+func (w *worker) applyBundle(env *environment, txs types.Transactions) error {
+	for i, tx := range txs {
+		env.state.Prepare(tx.Hash(), env.tcount)
+		if _, err := w.commitTransaction(env, tx); err != nil {
+			return fmt.Errorf("bundle transaction %d (%x) failed: %w", i, tx.Hash(), err)
+		}
+		env.tcount++
+		if env.receipts[len(env.receipts)-1].Status == types.ReceiptStatusFailed {
+			return fmt.Errorf("bundle transaction %d (%x) reverted", i, tx.Hash())
+		}
+	}
+	return nil
+}
+
+// replaceTransactions swaps the transactions included in the environment for any
+// of the given ones with the same sender and nonce but a higher effective tip. As
+// the swap affects the execution of everything after it, the environment is
+// rebuilt on top of its parent. The rebuilt environment is returned, or nil if
+// nothing was replaced or the replacement failed.
+func (w *worker) replaceTransactions(env *environment, txs []*types.Transaction) *environment {
+	type account struct {
+		from  common.Address
+		nonce uint64
+	}
+	baseFee := env.header.BaseFee[types.QuaiNetworkContext]
+
+	// Only the locally filled transactions are eligible, external ones come first
+	local := make(types.Transactions, env.tcount)
+	copy(local, env.txs[len(env.txs)-env.tcount:])
+
+	included := make(map[account]int, len(local))
+	for i, tx := range local {
+		from, _ := types.Sender(env.signer, tx)
+		included[account{from, tx.Nonce()}] = i
+	}
+	var replaced int
+	for _, tx := range txs {
+		from, _ := types.Sender(env.signer, tx)
+		i, ok := included[account{from, tx.Nonce()}]
+		if !ok || tx.EffectiveGasTipCmp(local[i], baseFee) <= 0 {
+			continue
+		}
+		log.Trace("Replacing pending transaction", "sender", from, "nonce", tx.Nonce(), "old", local[i].Hash(), "new", tx.Hash())
+		local[i] = tx
+		replaced++
+	}
+	if replaced == 0 {
+		return nil
+	}
+	// Re-execute the block with the replacements on top of the parent
+	parent := w.chain.GetBlockByHash(env.header.ParentHash[types.QuaiNetworkContext])
+	if parent == nil {
+		return nil
+	}
+	header := types.CopyHeader(env.header)
+	header.GasUsed[types.QuaiNetworkContext] = 0
+
+	rebuilt, err := w.makeEnv(parent, header, env.coinbase)
+	if err != nil {
+		log.Debug("Failed to rebuild sealing block for replacements", "err", err)
+		return nil
+	}
+	for hash, uncle := range env.uncles {
+		rebuilt.uncles[hash] = uncle
+	}
+	w.fillExternalTransactions(nil, rebuilt)
+	if err := w.commitBundle(rebuilt, local); err != nil {
+		log.Debug("Failed to apply pending transaction replacements", "err", err)
+		rebuilt.discard()
+		return nil
+	}
+	rebuilt.fillResult = env.fillResult
+	return rebuilt
+}
+
+func (w *worker) commitTransactions(env *environment, txs txIterator, interrupt *int32) bool {
 	gasLimit := env.header.GasLimit
 	if env.gasPool == nil {
 		env.gasPool = new(core.GasPool).AddGas(gasLimit[types.QuaiNetworkContext])
 	}
-	var coalescedLogs []*types.Log
-
+	var (
+		coalescedLogs []*types.Log
+		gasBound      bool                            // whether a transaction was skipped for not fitting the remaining gas
+		skipped       = make(map[common.Address]bool) // accounts whose remaining transactions were skipped
+	)
+	// Track the estimated encoded size of the included transactions if capped
+	var txBytes uint64
+	for _, tx := range env.txs {
+		txBytes += uint64(tx.Size())
+	}
+	filter := w.inclusionFilter(env)
 	for {
 		// In the following three cases, we will interrupt the execution of the transaction.
 		// (1) new head block event arrival, the interrupt signal is 1
@@ -860,21 +1829,42 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 				if ratio < 0.1 {
 					ratio = 0.1
 				}
-				w.resubmitAdjustCh <- &intervalAdjust{
+				w.adjustResubmit(&intervalAdjust{
 					ratio: ratio,
 					inc:   true,
-				}
+				})
 			}
+			env.fillResult = BlockFillResult{Reason: FillReasonInterrupt}
 			return atomic.LoadInt32(interrupt) == commitInterruptNewHead
 		}
 		// If we don't have enough gas for any further transactions then we're done
 		if env.gasPool.Gas() < params.TxGas {
 			log.Trace("Not enough gas for further transactions", "have", env.gasPool, "want", params.TxGas)
+			env.fillResult = BlockFillResult{Reason: FillReasonGas}
 			break
 		}
-		// Retrieve the next transaction and abort if all done
+		// Retrieve the next transaction, merging in the newly arrived ones once
+		// partway through the fill if enabled, and abort if all done
 		tx := txs.Peek()
+		if w.config.RefillDuringCommit && !env.refilled && refillDue(env, tx == nil) {
+			env.refilled = true
+			if fresh := w.requeryPending(env, skipped); len(fresh) > 0 {
+				txs = w.orderTransactions(env, fresh)
+				tx = txs.Peek()
+			}
+		}
 		if tx == nil {
+			if gasBound {
+				env.fillResult = BlockFillResult{Reason: FillReasonGas}
+			} else {
+				env.fillResult = BlockFillResult{Reason: FillReasonPoolEmpty}
+			}
+			break
+		}
+		// If the transaction doesn't fit into the byte size cap then we're done
+		if limit := w.config.MaxBlockBytes; limit > 0 && txBytes+uint64(tx.Size()) > limit {
+			log.Trace("Block byte size limit reached", "have", txBytes, "tx", tx.Size(), "limit", limit)
+			env.fillResult = BlockFillResult{Reason: FillReasonBytes}
 			break
 		}
 		// Error may be ignored here. The error has already been checked
@@ -882,11 +1872,21 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 		//
 		// We use the eip155 signer regardless of the current hf.
 		from, _ := types.Sender(env.signer, tx)
-		// Check whether the tx is replay protected. If we're not in the EIP155 hf
-		// phase, start ignoring the sender until we do.
-		if tx.Protected() && !w.chainConfig.IsEIP155(env.header.Number[types.QuaiNetworkContext]) {
-			log.Trace("Ignoring reply protected transaction", "hash", tx.Hash(), "eip155", w.chainConfig.EIP155Block)
+		// Check whether the tx passes the inclusion policies, otherwise start
+		// ignoring the sender.
+		if !filter(tx, from) {
+			log.Trace("Ignoring filtered transaction", "hash", tx.Hash(), "sender", from)
 
+			skipped[from] = true
+			txs.Pop()
+			continue
+		}
+		// Skip accounts which are too far ahead of their state nonce to be
+		// included without attempting to apply them.
+		if gap := w.config.MaxNonceGap; gap > 0 && tx.Nonce() > env.state.GetNonce(from)+gap {
+			log.Trace("Skipping account with nonce gap", "sender", from, "nonce", tx.Nonce(), "gap", gap)
+
+			skipped[from] = true
 			txs.Pop()
 			continue
 		}
@@ -898,6 +1898,8 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 		case errors.Is(err, core.ErrGasLimitReached):
 			// Pop the current out-of-gas transaction without shifting in the next from the account
 			log.Trace("Gas limit exceeded for current block", "sender", from)
+			gasBound = true
+			skipped[from] = true
 			txs.Pop()
 
 		case errors.Is(err, core.ErrNonceTooLow):
@@ -908,23 +1910,27 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 		case errors.Is(err, core.ErrNonceTooHigh):
 			// Reorg notification data race between the transaction pool and miner, skip account =
 			log.Trace("Skipping account with hight nonce", "sender", from, "nonce", tx.Nonce())
+			skipped[from] = true
 			txs.Pop()
 
 		case errors.Is(err, nil):
 			// Everything ok, collect the logs and shift in the next transaction from the same account
 			coalescedLogs = append(coalescedLogs, logs...)
 			env.tcount++
+			txBytes += uint64(tx.Size())
 			txs.Shift()
 
 		case errors.Is(err, core.ErrTxTypeNotSupported):
 			// Pop the unsupported transaction without shifting in the next from the account
 			log.Trace("Skipping unsupported transaction type", "sender", from, "type", tx.Type())
+			skipped[from] = true
 			txs.Pop()
 
 		default:
 			// Strange error, discard the transaction and get the next in line (note, the
 			// nonce-too-high clause will prevent us from executing in vain).
 			log.Debug("Transaction failed, account skipped", "hash", tx.Hash(), "err", err)
+			env.droppedTxs = append(env.droppedTxs, tx.Hash())
 			txs.Shift()
 		}
 	}
@@ -947,11 +1953,52 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 	// Notify resubmit loop to decrease resubmitting interval if current interval is larger
 	// than the user-specified one.
 	if interrupt != nil {
-		w.resubmitAdjustCh <- &intervalAdjust{inc: false}
+		w.adjustResubmit(&intervalAdjust{inc: false})
 	}
 	return false
 }
 
+// adjustResubmit hands the resubmit interval adjustment over to the work loop,
+// dropping it instead of blocking the sealing if the loop is lagging behind.
+func (w *worker) adjustResubmit(adjust *intervalAdjust) {
+	select {
+	case w.resubmitAdjustCh <- adjust:
+	default:
+		atomic.AddInt32(&w.lostAdjusts, 1)
+		log.Debug("Dropped resubmit interval adjustment", "inc", adjust.inc)
+	}
+}
+
+// inclusionFilter composes the custom transaction filter with the built-in
+// inclusion policies into the single predicate used for the given environment.
+func (w *worker) inclusionFilter(env *environment) TxFilter {
+	w.mu.RLock()
+	custom, ready, deadline := w.txFilter, w.txReady, w.txDeadline
+	w.mu.RUnlock()
+
+	eip155 := w.chainConfig.IsEIP155(env.header.Number[types.QuaiNetworkContext])
+	return func(tx *types.Transaction, from common.Address) bool {
+		if custom != nil && !custom(tx, from) {
+			return false
+		}
+		// Defer transactions which are not ready at the block's timestamp
+		if ready != nil && !ready(tx, env.header.Time) {
+			return false
+		}
+		// Exclude transactions past their deadline at the block's timestamp
+		if deadline != nil {
+			if until, ok := deadline(tx); ok && until < env.header.Time {
+				return false
+			}
+		}
+		// Ignore replay protected transactions until the EIP155 hf phase
+		if tx.Protected() && !eip155 {
+			return false
+		}
+		return true
+	}
+}
+
 // generateParams wraps various of settings for generating sealing task.
 type generateParams struct {
 	timestamp  uint64         // The timstamp for sealing task
@@ -971,9 +2018,9 @@ func (w *worker) prepareWork(genParams *generateParams) (*environment, error) {
 	defer w.mu.RUnlock()
 
 	// Find the parent block for sealing task
-	parent := w.chain.CurrentBlock()
+	parent := w.currentBlock()
 	if parent == nil {
-		return nil, fmt.Errorf("missing parent")
+		return nil, errMissingParent
 	}
 	// Sanity check the timestamp correctness, recap the timestamp
 	// to parent+1 if the mutation is allowed.
@@ -1005,12 +2052,14 @@ func (w *worker) prepareWork(genParams *generateParams) (*environment, error) {
 	}
 	header.ParentHash[types.QuaiNetworkContext] = parent.Hash()
 	header.Number[types.QuaiNetworkContext] = big.NewInt(int64(num.Uint64()) + 1)
-	header.Extra[types.QuaiNetworkContext] = w.extra
-	header.BaseFee[types.QuaiNetworkContext] = misc.CalcBaseFee(w.chainConfig, parent.Header(), w.chain.GetHeaderByNumber, w.chain.GetUnclesInChain, w.chain.GetGasUsedInChain)
+	if !genParams.noExtra {
+		header.Extra[types.QuaiNetworkContext] = w.extra
+	}
+	header.BaseFee[types.QuaiNetworkContext] = w.calcBaseFee(parent.Header())
 	if w.isRunning() {
-		if w.coinbase == (common.Address{}) {
-			log.Error("Refusing to mine without etherbase")
-			return nil, errors.New("refusing to mine without etherbase")
+		if err := w.validateCoinbase(w.coinbase); err != nil {
+			log.Error("Refusing to mine to invalid etherbase", "err", err)
+			return nil, err
 		}
 		header.Coinbase[types.QuaiNetworkContext] = w.coinbase
 	}
@@ -1018,20 +2067,30 @@ func (w *worker) prepareWork(genParams *generateParams) (*environment, error) {
 	// Run the consensus preparation with the default or customized consensus engine.
 	if err := w.engine.Prepare(w.chain, header); err != nil {
 		log.Error("Failed to prepare header for sealing", "err", err)
+		w.prepareFailed(err)
 		return nil, err
 	}
+	atomic.StoreInt32(&w.prepareMiss, 0)
 
 	env, err := w.makeEnv(parent, header, w.coinbase)
 	if err != nil {
 		log.Error("Failed to create sealing context", "err", err)
 		return nil, err
 	}
-	// Accumulate the uncles for the sealing work.
+	// Accumulate the uncles for the sealing work if it's allowed.
+	if genParams.noUncle {
+		return env, nil
+	}
 	commitUncles := func(blocks map[common.Hash]*types.Block) {
-		for hash, uncle := range blocks {
+		for _, uncle := range orderUncles(blocks) {
 			if len(env.uncles) == 2 {
 				break
 			}
+			hash := uncle.Hash()
+			if w.config.ExcludeSelfUncles && w.isLocalBlock != nil && w.isLocalBlock(uncle.Header()) {
+				log.Trace("Skipping self-mined uncle", "hash", hash)
+				continue
+			}
 			if err := w.commitUncle(env, uncle.Header()); err != nil {
 				log.Trace("Possible uncle rejected", "hash", hash, "reason", err)
 			} else {
@@ -1042,6 +2101,9 @@ func (w *worker) prepareWork(genParams *generateParams) (*environment, error) {
 	// Prefer to locally generated uncle
 	commitUncles(w.localUncles)
 	commitUncles(w.remoteUncles)
+	if depth := w.config.UncleScanDepth; depth > 0 {
+		commitUncles(w.scanUncles(parent.NumberU64(), depth))
+	}
 
 	return env, nil
 }
@@ -1070,34 +2132,163 @@ func (w *worker) fillExternalTransactions(interrupt *int32, env *environment) {
 // fillTransactions retrieves the pending transactions from the txpool and fills them
 // into the given sealing block. The transaction selection and ordering strategy can
 // be customized with the plugin in the future.
-func (w *worker) fillTransactions(interrupt *int32, env *environment) {
-	// Split the pending transactions into locals and remotes
+func (w *worker) fillTransactions(interrupt *int32, env *environment) error {
+	// Split the pending transactions into coinbase, locals and remotes
 	// Fill the block with all available pending transactions.
-	pending, err := w.eth.TxPool().Pending(true)
+	env.fillResult = BlockFillResult{Reason: FillReasonPoolEmpty}
+
+	pending, err := w.pendingTransactions()
 	if err != nil {
-		return
+		log.Warn("Failed to retrieve pending transactions", "err", err)
+		go w.txPoolErrFeed.Send(TxPoolFailure{Err: err})
+		return err
+	}
+	if w.config.SpeculativePrefetch && len(pending) > 0 {
+		stop := make(chan struct{})
+		defer close(stop)
+		go prefetchAccounts(env.state.Copy(), txAccounts(pending), stop)
+	}
+	coinbaseTxs, localTxs, remoteTxs := make(map[common.Address]types.Transactions), make(map[common.Address]types.Transactions), pending
+	if w.config.PrioritizeCoinbaseTxs {
+		if txs := remoteTxs[env.coinbase]; len(txs) > 0 {
+			delete(remoteTxs, env.coinbase)
+			coinbaseTxs[env.coinbase] = txs
+		}
 	}
-	localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
 	for _, account := range w.eth.TxPool().Locals() {
 		if txs := remoteTxs[account]; len(txs) > 0 {
 			delete(remoteTxs, account)
 			localTxs[account] = txs
 		}
 	}
+	if len(coinbaseTxs) > 0 {
+		txs := w.orderTransactions(env, coinbaseTxs)
+		if w.commitTransactions(env, txs, interrupt) {
+			return nil
+		}
+	}
 	if len(localTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(env.signer, localTxs, env.header.BaseFee[types.QuaiNetworkContext])
+		txs := w.orderTransactions(env, localTxs)
 		if w.commitTransactions(env, txs, interrupt) {
-			return
+			return nil
 		}
 	}
 	if len(remoteTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(env.signer, remoteTxs, env.header.BaseFee[types.QuaiNetworkContext])
+		txs := w.orderTransactions(env, remoteTxs)
 		if w.commitTransactions(env, txs, interrupt) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// refillDue reports whether the pending transactions should be re-queried while
+// filling the sealing block: once half of the block gas is used up, or earlier
+// if the transactions at hand ran out, as long as a substantial part of the
+// block gas is still available.
+func refillDue(env *environment, exhausted bool) bool {
+	limit, left := env.header.GasLimit[types.QuaiNetworkContext], env.gasPool.Gas()
+	if left < limit/refillGasDivisor {
+		return false
+	}
+	return exhausted || left <= limit/2
+}
+
+// requeryPending re-queries the pending transactions, keeping the ones not yet
+// executed in the sealing block from accounts which weren't skipped during the
+// fill so far.
+func (w *worker) requeryPending(env *environment, skipped map[common.Address]bool) map[common.Address]types.Transactions {
+	pending, err := w.pendingTransactions()
+	if err != nil {
+		log.Debug("Failed to re-query pending transactions", "err", err)
+		return nil
+	}
+	dropped := make(map[common.Hash]bool, len(env.droppedTxs))
+	for _, hash := range env.droppedTxs {
+		dropped[hash] = true
+	}
+	fresh := make(map[common.Address]types.Transactions)
+	for from, txs := range pending {
+		if skipped[from] {
+			continue
+		}
+		nonce := env.state.GetNonce(from)
+		for _, tx := range txs {
+			// Transactions after a failed one can't be executed either
+			if dropped[tx.Hash()] {
+				break
+			}
+			if tx.Nonce() >= nonce {
+				fresh[from] = append(fresh[from], tx)
+			}
+		}
+	}
+	return fresh
+}
+
+// txAccounts collects the senders and recipients of the given transactions.
+func txAccounts(txs map[common.Address]types.Transactions) []common.Address {
+	accounts := make([]common.Address, 0, len(txs))
+	for from, list := range txs {
+		accounts = append(accounts, from)
+		for _, tx := range list {
+			if to := tx.To(); to != nil {
+				accounts = append(accounts, *to)
+			}
+		}
+	}
+	return accounts
+}
+
+// prefetchAccounts loads the given accounts and their code into a throwaway copy
+// of the sealing state, warming up the shared caches for the transactions about
+// to be applied without affecting the state they are committed to.
+func prefetchAccounts(statedb *state.StateDB, accounts []common.Address, stop <-chan struct{}) {
+	for _, addr := range accounts {
+		select {
+		case <-stop:
 			return
+		default:
 		}
+		statedb.GetNonce(addr)
+		statedb.GetCode(addr)
 	}
 }
 
+// orderTransactions creates an iterator over the given transactions in the order
+// configured for inclusion into the sealing block.
+//
+// Note, the input map is reowned by the returned iterator.
+func (w *worker) orderTransactions(env *environment, txs map[common.Address]types.Transactions) txIterator {
+	baseFee := env.header.BaseFee[types.QuaiNetworkContext]
+	if w.config.TxOrdering == TxOrderingFIFO {
+		return types.NewTransactionsByTimeAndNonce(env.signer, txs, baseFee)
+	}
+	if baseFee == nil {
+		// Without a base fee the effective tips are the plain gas tip caps,
+		// which amounts to the legacy gas price ordering.
+		log.Debug("Ordering transactions by gas price without base fee", "number", env.header.Number[types.QuaiNetworkContext])
+	}
+	return types.NewTransactionsByPriceAndNonce(env.signer, txs, baseFee)
+}
+
+// pendingTransactions retrieves all currently processable transactions from
+// the transaction pool, grouped by origin account.
+func (w *worker) pendingTransactions() (map[common.Address]types.Transactions, error) {
+	if w.pendingHook != nil {
+		return w.pendingHook()
+	}
+	return w.eth.TxPool().Pending(true)
+}
+
+// currentBlock retrieves the chain head to build the sealing block on top of.
+func (w *worker) currentBlock() *types.Block {
+	if w.headHook != nil {
+		return w.headHook()
+	}
+	return w.chain.CurrentBlock()
+}
+
 // fillTransactions retrieves the pending transactions from the txpool and fills them
 // into the given sealing block. The transaction selection and ordering strategy can
 // be customized with the plugin in the future.
@@ -1105,13 +2296,36 @@ func (w *worker) adjustGasLimit(interrupt *int32, env *environment) {
 	// Find the parent block for sealing task
 	parent := w.chain.CurrentBlock()
 
-	gasUsed := (parent.GasUsed() + env.externalGasUsed) / uint64(env.externalBlockLength+1)
+	// Average the gas used over the parent and the referenced external blocks,
+	// bounding the influence of the latter if configured.
+	externalGasUsed := env.externalGasUsed
+	if factor := w.config.MaxExternalGasFactor; factor > 0 {
+		if limit := factor * parent.GasLimit(); externalGasUsed > limit {
+			externalGasUsed = limit
+		}
+	}
+	gasUsed := (parent.GasUsed() + externalGasUsed) / uint64(env.externalBlockLength+1)
 
-	// Get the amount of uncles for the past 1000 blocks
 	prevBlock := w.chain.GetBlockByHash(env.header.ParentHash[types.QuaiNetworkContext])
-	uncleCount := len(w.chain.GetUnclesInChain(prevBlock, 1000))
+	uncleCount := w.recentUncleCount(prevBlock)
+
+	gasLimit := core.CalcGasLimit(parent.GasLimit(), gasUsed, uncleCount)
 
-	env.header.GasLimit[types.QuaiNetworkContext] = core.CalcGasLimit(parent.GasLimit(), gasUsed, uncleCount)
+	// Bound the change from the parent gas limit if configured
+	if delta := w.config.MaxGasLimitDelta; delta > 0 {
+		if gasLimit > parent.GasLimit()+delta {
+			gasLimit = parent.GasLimit() + delta
+		} else if parent.GasLimit() > delta && gasLimit < parent.GasLimit()-delta {
+			gasLimit = parent.GasLimit() - delta
+		}
+	}
+	env.header.GasLimit[types.QuaiNetworkContext] = gasLimit
+}
+
+// recentUncleCount returns the number of uncles included in the configured window
+// of blocks ending with the given one.
+func (w *worker) recentUncleCount(block *types.Block) int {
+	return len(w.chain.GetUnclesInChain(block, w.gasLimitUncleWindow()))
 }
 
 // generateWork generates a sealing block based on the given parameters.
@@ -1124,7 +2338,9 @@ func (w *worker) generateWork(params *generateParams) (*types.Block, error) {
 
 	w.fillExternalTransactions(nil, work)
 	w.adjustGasLimit(nil, work)
-	w.fillTransactions(nil, work)
+	if err := w.fillTransactions(nil, work); err != nil && w.config.FailOnEmptyPool {
+		return nil, err
+	}
 	return w.engine.FinalizeAndAssemble(w.chain, work.header, work.state, work.txs, work.unclelist(), work.receipts)
 }
 
@@ -1136,16 +2352,25 @@ func (w *worker) commitWork(interrupt *int32, noempty bool, timestamp int64) {
 	// Set the coinbase if the worker is running or it's required
 	var coinbase common.Address
 	if w.isRunning() {
-		if w.coinbase == (common.Address{}) {
-			log.Error("Refusing to mine without etherbase")
+		if err := w.validateCoinbase(w.coinbase); err != nil {
+			log.Error("Refusing to mine to invalid etherbase", "err", err)
 			return
 		}
 		coinbase = w.coinbase // Use the preset address as the fee recipient
 	}
+	if head := w.chain.CurrentBlock(); head != nil && w.assemblyBlocked(head.Hash()) {
+		log.Debug("Skipping sealing on parent failing to assemble", "parent", head.Hash())
+		return
+	}
 	work, err := w.prepareWork(&generateParams{
 		timestamp: uint64(timestamp),
 		coinbase:  coinbase,
 	})
+	if errors.Is(err, errMissingParent) {
+		atomic.AddInt32(&w.parentMiss, 1)
+	} else {
+		atomic.StoreInt32(&w.parentMiss, 0)
+	}
 	if err != nil {
 		return
 	}
@@ -1157,8 +2382,25 @@ func (w *worker) commitWork(interrupt *int32, noempty bool, timestamp int64) {
 	// Fill pending transactions from the txpool
 	w.fillExternalTransactions(nil, work)
 	w.adjustGasLimit(nil, work)
-	w.fillTransactions(interrupt, work)
-	w.commit(work.copy(), w.fullTaskHook, true, start)
+	if err := w.fillTransactions(interrupt, work); err != nil && w.config.FailOnEmptyPool {
+		log.Warn("Aborting sealing cycle due to transaction pool failure", "err", err)
+		work.discard()
+		return
+	}
+	if w.isRunning() {
+		if work.tcount == 0 {
+			atomic.AddInt32(&w.idleCycles, 1)
+		} else {
+			atomic.StoreInt32(&w.idleCycles, 0)
+		}
+	}
+	if work.tcount == 0 && !w.config.SealEmptyBlocks {
+		// Keep the pending block up to date without sealing it
+		log.Debug("Skipping empty sealing block", "number", work.header.Number[types.QuaiNetworkContext])
+		w.updatePending(work, w.isRunning())
+	} else {
+		w.commit(work.copy(), w.fullTaskHook, true, start)
+	}
 
 	// Swap out the old work with the new one, terminating any leftover
 	// prefetcher processes in the mean time and starting a new one.
@@ -1173,7 +2415,8 @@ func (w *worker) commitWork(interrupt *int32, noempty bool, timestamp int64) {
 // Note the assumption is held that the mutation is allowed to the passed env, do
 // the deep copy first.
 func (w *worker) commit(env *environment, interval func(), update bool, start time.Time) error {
-	if w.isRunning() {
+	running := w.isRunning()
+	if running {
 		if interval != nil {
 			interval()
 		}
@@ -1182,8 +2425,18 @@ func (w *worker) commit(env *environment, interval func(), update bool, start ti
 		env := env.copy()
 		block, err := w.engine.FinalizeAndAssemble(w.chain, env.header, env.state, env.txs, env.unclelist(), env.receipts)
 		if err != nil {
+			w.assemblyFailed(env.header.ParentHash[types.QuaiNetworkContext], err)
 			return err
 		}
+		w.assemblyMiss = 0
+
+		if w.config.PreventDoubleSealing {
+			target := sealTarget{context: types.QuaiNetworkContext, parent: block.ParentHash()}
+			if !w.sealGuard.acquire(target, w) {
+				log.Warn("Refusing to seal competing block", "number", block.Number(), "parent", block.ParentHash())
+				return errSealBusy
+			}
+		}
 		select {
 		case w.taskCh <- &task{receipts: env.receipts, state: env.state, block: block, createdAt: time.Now()}:
 			w.unconfirmed.Shift(block.NumberU64() - 1)
@@ -1198,8 +2451,28 @@ func (w *worker) commit(env *environment, interval func(), update bool, start ti
 
 	}
 	if update {
-		w.updateSnapshot(env)
+		return w.updatePending(env, running)
+	}
+	return nil
+}
+
+// updatePending updates the pending snapshot with the given environment. If
+// sealing isn't running and templates are retained, the assembled block is kept
+// as the pending one for template consumers, even though it is not handed over
+// for sealing.
+func (w *worker) updatePending(env *environment, running bool) error {
+	w.updateSnapshot(env)
+	if running || !w.config.RetainTemplatesWhenStopped {
+		return nil
+	}
+	env = env.copy()
+	block, err := w.engine.FinalizeAndAssemble(w.chain, env.header, env.state, env.txs, env.unclelist(), env.receipts)
+	if err != nil {
+		return err
 	}
+	w.snapshotMu.Lock()
+	w.snapshotBlock = block
+	w.snapshotMu.Unlock()
 	return nil
 }
 
@@ -1229,6 +2502,54 @@ func (w *worker) getSealingBlock(parent common.Hash, timestamp uint64, coinbase
 	}
 }
 
+// calcBaseFee calculates the base fee of the block built on top of the given
+// parent, clamped to the configured minimum.
+func (w *worker) calcBaseFee(parent *types.Header) *big.Int {
+	baseFee := misc.CalcBaseFee(w.chainConfig, parent, w.chain.GetHeaderByNumber, w.chain.GetUnclesInChain, w.chain.GetGasUsedInChain)
+	if floor := w.config.MinBaseFee; floor != nil && floor.Sign() > 0 && baseFee != nil && baseFee.Cmp(floor) < 0 {
+		return new(big.Int).Set(floor)
+	}
+	return baseFee
+}
+
+// refreshBaseFee recommits the current sealing block, recomputing its base fee,
+// and updates the pending snapshot accordingly.
+func (w *worker) refreshBaseFee() {
+	done := make(chan struct{})
+	select {
+	case w.baseFeeCh <- done:
+		<-done
+	case <-w.exitCh:
+	}
+}
+
+// remainingGas returns the gas left in the current sealing block, along with a
+// flag whether such a block is available.
+func (w *worker) remainingGas() (uint64, bool) {
+	result := make(chan *core.GasPool, 1)
+	select {
+	case w.gasPoolCh <- result:
+		if gp := <-result; gp != nil {
+			return gp.Gas(), true
+		}
+		return 0, false
+	case <-w.exitCh:
+		return 0, false
+	}
+}
+
+// submitBundle commits the given transactions atomically into the current
+// sealing block.
+func (w *worker) submitBundle(txs types.Transactions) error {
+	req := &bundleReq{txs: txs, result: make(chan error, 1)}
+	select {
+	case w.bundleCh <- req:
+		return <-req.result
+	case <-w.exitCh:
+		return errors.New("miner closed")
+	}
+}
+
 // copyReceipts makes a deep copy of the given receipts.
 func copyReceipts(receipts []*types.Receipt) []*types.Receipt {
 	result := make([]*types.Receipt, len(receipts))
@@ -1249,10 +2570,16 @@ func (w *worker) postSideBlock(event core.ChainSideEvent) {
 
 // totalFees computes total consumed miner fees in ETH. Block transactions and receipts have to have the same order.
 func totalFees(block *types.Block, receipts []*types.Receipt) *big.Float {
+	feesWei := accumulatedFees(block.Transactions(), receipts, block.BaseFee())
+	return new(big.Float).Quo(new(big.Float).SetInt(feesWei), new(big.Float).SetInt(big.NewInt(params.Ether)))
+}
+
+// accumulatedFees computes the miner fees in wei paid by the given transactions.
+func accumulatedFees(txs []*types.Transaction, receipts []*types.Receipt, baseFee *big.Int) *big.Int {
 	feesWei := new(big.Int)
-	for i, tx := range block.Transactions() {
-		minerFee, _ := tx.EffectiveGasTip(block.BaseFee())
+	for i, tx := range txs {
+		minerFee, _ := tx.EffectiveGasTip(baseFee)
 		feesWei.Add(feesWei, new(big.Int).Mul(new(big.Int).SetUint64(receipts[i].GasUsed), minerFee))
 	}
-	return new(big.Float).Quo(new(big.Float).SetInt(feesWei), new(big.Float).SetInt(big.NewInt(params.Ether)))
+	return feesWei
 }